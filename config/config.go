@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"slices"
 	"sync"
 
 	"gopkg.in/yaml.v3"
@@ -16,6 +18,7 @@ import (
 const (
 	defaultEncryptionKey = "s5PYArGj8RdLC6rKZfxQttlMFt17lBlY"
 	defaultConfigFile    = "sparkle-config.yaml"
+	defaultCacheFile     = "sparkle-cache.db"
 )
 
 type ConfigManager struct {
@@ -35,6 +38,18 @@ type Config struct {
 	Http       EncryptedString `yaml:"http-controller"`
 	NamedPipe  EncryptedString `yaml:"named-pipe"`
 	UnixSocket EncryptedString `yaml:"unix-socket"`
+	// SandboxPool 预创建的配置测试沙盒数量，0 表示不使用沙盒池
+	SandboxPool int `yaml:"sandbox-pool"`
+	// CheckParallelism 同时运行的配置测试数量，超出的请求排队等待
+	CheckParallelism int `yaml:"check-parallelism"`
+	// RestoreOnDisable 关闭系统代理时恢复接管前的代理设置
+	RestoreOnDisable bool `yaml:"restore-on-disable"`
+	// SysproxyGuard 系统代理被其他程序修改时自动恢复
+	SysproxyGuard bool `yaml:"sysproxy-guard"`
+	// SysproxyTargets 同时写入代理设置的命令行工具
+	SysproxyTargets []string `yaml:"sysproxy-targets"`
+	// SysproxyConnections NetworkManager 后端修改的连接，为空时修改所有活动连接
+	SysproxyConnections []string `yaml:"sysproxy-nm-connections"`
 }
 
 type EncryptedString string
@@ -121,6 +136,13 @@ func GetConfig() Config {
 		Http:       EncryptedString(GetHttp()),
 		NamedPipe:  EncryptedString(GetNamedPipe()),
 		UnixSocket: EncryptedString(GetUnixSocket()),
+
+		SandboxPool:         GetSandboxPool(),
+		CheckParallelism:    GetCheckParallelism(),
+		RestoreOnDisable:    GetRestoreOnDisable(),
+		SysproxyGuard:       GetSysproxyGuard(),
+		SysproxyTargets:     GetSysproxyTargets(),
+		SysproxyConnections: GetSysproxyConnections(),
 	}
 }
 
@@ -156,6 +178,48 @@ func UpdateConfig(coreName, coreDir, configPath, workDir, logPath, secret, http,
 	return nil
 }
 
+// UpdateSandboxConfig 更新沙盒池设置，参数为空时保持原值
+func UpdateSandboxConfig(pool, parallelism *int) error {
+	manager.Lock()
+	if pool != nil && *pool >= 0 {
+		manager.cfg.SandboxPool = *pool
+	}
+	if parallelism != nil && *parallelism >= 0 {
+		manager.cfg.CheckParallelism = *parallelism
+	}
+	manager.Unlock()
+	return manager.save()
+}
+
+// UpdateSysproxyConfig 更新系统代理设置，参数为空时保持原值
+func UpdateSysproxyConfig(restoreOnDisable, guard *bool) error {
+	manager.Lock()
+	if restoreOnDisable != nil {
+		manager.cfg.RestoreOnDisable = *restoreOnDisable
+	}
+	if guard != nil {
+		manager.cfg.SysproxyGuard = *guard
+	}
+	manager.Unlock()
+	return manager.save()
+}
+
+// UpdateSysproxyTargets 更新启用的命令行代理目标
+func UpdateSysproxyTargets(targets []string) error {
+	manager.Lock()
+	manager.cfg.SysproxyTargets = slices.Clone(targets)
+	manager.Unlock()
+	return manager.save()
+}
+
+// UpdateSysproxyConnections 更新 NetworkManager 后端修改的连接
+func UpdateSysproxyConnections(connections []string) error {
+	manager.Lock()
+	manager.cfg.SysproxyConnections = slices.Clone(connections)
+	manager.Unlock()
+	return manager.save()
+}
+
 func GetCoreName() string   { return manager.getString(manager.cfg.CoreName) }
 func GetCoreDir() string    { return manager.getString(manager.cfg.CoreDir) }
 func GetConfigPath() string { return manager.getString(manager.cfg.ConfigPath) }
@@ -166,6 +230,47 @@ func GetHttp() string       { return manager.getString(manager.cfg.Http) }
 func GetNamedPipe() string  { return manager.getString(manager.cfg.NamedPipe) }
 func GetUnixSocket() string { return manager.getString(manager.cfg.UnixSocket) }
 
+func GetSandboxPool() int {
+	manager.RLock()
+	defer manager.RUnlock()
+	return manager.cfg.SandboxPool
+}
+
+func GetCheckParallelism() int {
+	manager.RLock()
+	defer manager.RUnlock()
+	return manager.cfg.CheckParallelism
+}
+
+func GetRestoreOnDisable() bool {
+	manager.RLock()
+	defer manager.RUnlock()
+	return manager.cfg.RestoreOnDisable
+}
+
+func GetSysproxyGuard() bool {
+	manager.RLock()
+	defer manager.RUnlock()
+	return manager.cfg.SysproxyGuard
+}
+
+func GetSysproxyTargets() []string {
+	manager.RLock()
+	defer manager.RUnlock()
+	return slices.Clone(manager.cfg.SysproxyTargets)
+}
+
+func GetSysproxyConnections() []string {
+	manager.RLock()
+	defer manager.RUnlock()
+	return slices.Clone(manager.cfg.SysproxyConnections)
+}
+
+// GetCacheFile 返回与配置文件同目录的缓存数据库路径
+func GetCacheFile() string {
+	return filepath.Join(filepath.Dir(manager.configFile), defaultCacheFile)
+}
+
 func (es EncryptedString) MarshalYAML() (any, error) {
 	block, err := aes.NewCipher(manager.encryptKey)
 	if err != nil {
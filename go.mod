@@ -5,6 +5,7 @@ go 1.22.0
 require (
 	github.com/go-chi/chi/v5 v5.2.1
 	github.com/go-chi/render v1.0.3
+	github.com/godbus/dbus/v5 v5.2.2
 	github.com/kardianos/service v1.2.2
 	github.com/metacubex/bbolt v0.0.0-20240822011022-aed6d4850399
 	github.com/spf13/cobra v1.9.1
@@ -0,0 +1,240 @@
+package manager
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"sparkle-service/config"
+	"strings"
+)
+
+// BypassList 为统一格式的代理例外列表，ProxyConfig 中以逗号连接保存。每一项为以下之一：
+//   - <local>：不含点的主机名
+//   - IP 地址，IPv6 地址不带方括号
+//   - CIDR 网段
+//   - 主机名，可以包含 * 通配符，.example.com 统一写作 *.example.com
+//
+// 各后端的格式不同，写入时转换为后端的格式，后端无法表示的项返回错误
+type BypassList []string
+
+const (
+	bypassLocal    = "local"
+	bypassIP       = "ip"
+	bypassCIDR     = "cidr"
+	bypassHost     = "host"
+	bypassWildcard = "wildcard"
+)
+
+var bypassHostPattern = regexp.MustCompile(`^[a-z0-9*_-]+(\.[a-z0-9*_-]+)*$`)
+
+// ParseBypass 解析以逗号、分号或空白分隔的例外列表并校验每一项
+func ParseBypass(s string) (BypassList, error) {
+	list := BypassList{}
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	}) {
+		item = normalizeBypass(item)
+		if bypassKind(item) == "" {
+			return nil, fmt.Errorf("无效的例外地址：%s", item)
+		}
+		if !slices.Contains(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list, nil
+}
+
+// parseNativeBypass 读取后端原有的例外列表，无法识别的项原样保留
+func parseNativeBypass(items []string) BypassList {
+	list := BypassList{}
+	for _, item := range items {
+		if item = normalizeBypass(item); item != "" && !slices.Contains(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// splitBypass 拆分 ProxyConfig 中保存的例外列表
+func splitBypass(s string) BypassList {
+	return parseNativeBypass(strings.Split(s, ","))
+}
+
+func normalizeBypass(item string) string {
+	item = strings.TrimSpace(item)
+	if strings.EqualFold(item, "<local>") {
+		return "<local>"
+	}
+	item = strings.ToLower(item)
+	if strings.HasPrefix(item, "[") && strings.HasSuffix(item, "]") {
+		item = item[1 : len(item)-1]
+	}
+	if strings.HasPrefix(item, ".") {
+		item = "*" + item
+	}
+	return item
+}
+
+// bypassKind 返回例外项的类型，无效的项返回空字符串
+func bypassKind(item string) string {
+	switch {
+	case item == "<local>":
+		return bypassLocal
+	case net.ParseIP(item) != nil:
+		return bypassIP
+	case strings.Contains(item, "/"):
+		if _, _, err := net.ParseCIDR(item); err == nil {
+			return bypassCIDR
+		}
+	case bypassHostPattern.MatchString(item):
+		if strings.Contains(item, "*") {
+			return bypassWildcard
+		}
+		return bypassHost
+	}
+	return ""
+}
+
+func (l BypassList) String() string {
+	return strings.Join(l, ",")
+}
+
+// validateBypass 检查例外列表能否写入每个后端，启用命令行代理目标时同时检查 no_proxy
+func validateBypass(l BypassList, backends []string) error {
+	if len(config.GetSysproxyTargets()) > 0 {
+		if _, err := l.Env(); err != nil {
+			return err
+		}
+	}
+	for _, backend := range backends {
+		var err error
+		switch backend {
+		case "kde", "kde5", "kde6":
+			_, err = l.KDE()
+		case "gnome", "cinnamon", "mate", "budgie", "deepin":
+			_, err = l.GNOME()
+		case "xfce", "lxqt":
+			_, err = l.Env()
+		case "networkmanager":
+			_, err = l.Pac()
+		case "networksetup":
+			_, err = l.Networksetup()
+		case "wininet":
+			_, err = l.Windows()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatBypass 依次转换每一项，convert 返回 false 表示后端无法表示，
+// 无效的项为读取自后端的原有设置，原样保留
+func formatBypass(l BypassList, backend string, convert func(item, kind string) (string, bool)) ([]string, error) {
+	items := []string{}
+	for _, item := range l {
+		kind := bypassKind(item)
+		if kind == "" {
+			items = append(items, item)
+			continue
+		}
+		converted, ok := convert(item, kind)
+		if !ok {
+			return nil, fmt.Errorf("%s 不支持例外地址：%s", backend, item)
+		}
+		items = append(items, converted)
+	}
+	return items, nil
+}
+
+// leadingWildcard 判断通配符是否只出现在开头的 *. 中
+func leadingWildcard(item string) bool {
+	rest, ok := strings.CutPrefix(item, "*.")
+	return ok && !strings.Contains(rest, "*")
+}
+
+// GNOME ignore-hosts 支持主机名、*. 开头的通配符、IP 与网段
+func (l BypassList) GNOME() ([]string, error) {
+	return formatBypass(l, "GNOME", func(item, kind string) (string, bool) {
+		return item, kind != bypassLocal && (kind != bypassWildcard || leadingWildcard(item))
+	})
+}
+
+// KDE NoProxyFor 以逗号分隔，子域名使用 . 开头的写法
+func (l BypassList) KDE() (string, error) {
+	items, err := formatBypass(l, "KDE", func(item, kind string) (string, bool) {
+		if kind == bypassWildcard && leadingWildcard(item) {
+			return strings.TrimPrefix(item, "*"), true
+		}
+		return item, kind != bypassLocal && kind != bypassWildcard
+	})
+	return strings.Join(items, ","), err
+}
+
+// Env 为 no_proxy 环境变量，子域名使用 . 开头的写法，* 表示全部地址
+func (l BypassList) Env() (string, error) {
+	items, err := formatBypass(l, "no_proxy", func(item, kind string) (string, bool) {
+		if kind == bypassWildcard && leadingWildcard(item) {
+			return strings.TrimPrefix(item, "*"), true
+		}
+		return item, kind != bypassLocal && (kind != bypassWildcard || item == "*")
+	})
+	return strings.Join(items, ","), err
+}
+
+// Windows 例外列表以分号分隔，不支持网段，按字节对齐的 IPv4 网段转换为通配符
+func (l BypassList) Windows() (string, error) {
+	items, err := formatBypass(l, "Windows", func(item, kind string) (string, bool) {
+		if kind != bypassCIDR {
+			return item, true
+		}
+		_, network, _ := net.ParseCIDR(item)
+		ones, bits := network.Mask.Size()
+		ip := network.IP.To4()
+		if bits != 32 || ones%8 != 0 {
+			return "", false
+		}
+		var octets []string
+		for _, b := range ip[:ones/8] {
+			octets = append(octets, fmt.Sprint(b))
+		}
+		if ones == 32 {
+			return strings.Join(octets, "."), true
+		}
+		return strings.Join(append(octets, "*"), "."), true
+	})
+	return strings.Join(items, ";"), err
+}
+
+// Networksetup 为 networksetup -setproxybypassdomains 的参数，
+// 不含点的主机名由单独的 ExcludeSimpleHostnames 选项控制，不能写在例外列表中
+func (l BypassList) Networksetup() ([]string, error) {
+	return formatBypass(l, "networksetup", func(item, kind string) (string, bool) {
+		return item, kind != bypassLocal
+	})
+}
+
+// Pac 为 PAC 脚本中的条件，isInNet 只支持 IPv4 网段
+func (l BypassList) Pac() ([]string, error) {
+	// 无效的项不能原样写入脚本
+	for _, item := range l {
+		if bypassKind(item) == "" {
+			return nil, fmt.Errorf("PAC 不支持例外地址：%s", item)
+		}
+	}
+	return formatBypass(l, "PAC", func(item, kind string) (string, bool) {
+		switch kind {
+		case bypassLocal:
+			return "isPlainHostName(host)", true
+		case bypassCIDR:
+			_, network, _ := net.ParseCIDR(item)
+			if network.IP.To4() == nil {
+				return "", false
+			}
+			return fmt.Sprintf("isInNet(host, \"%s\", \"%s\")", network.IP, net.IP(network.Mask)), true
+		}
+		return fmt.Sprintf("shExpMatch(host, %q)", item), true
+	})
+}
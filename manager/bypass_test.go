@@ -0,0 +1,172 @@
+package manager
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBypass(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		want  BypassList
+	}{
+		{"", BypassList{}},
+		{"<LOCAL>, .Example.com;10.0.0.0/8  localhost", BypassList{"<local>", "*.example.com", "10.0.0.0/8", "localhost"}},
+		{"[::1],2001:DB8::1,fd00::/8", BypassList{"::1", "2001:db8::1", "fd00::/8"}},
+		{"*.lan,www.*.com,*", BypassList{"*.lan", "www.*.com", "*"}},
+		{"example.com,EXAMPLE.com,.a.com,*.a.com", BypassList{"example.com", "*.a.com"}},
+	} {
+		got, err := ParseBypass(tt.input)
+		if err != nil {
+			t.Errorf("ParseBypass(%q) error = %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseBypass(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"exa$mple.com", "10.0.0.0/33", "[::1", "http://example.com", "a..b"} {
+		if _, err := ParseBypass(input); err == nil || !strings.Contains(err.Error(), "无效的例外地址") {
+			t.Errorf("ParseBypass(%q) error = %v, want 无效的例外地址", input, err)
+		}
+	}
+}
+
+// bypassBackends 将例外列表写成各后端的格式，再按后端读取设置的方式还原
+var bypassBackends = []struct {
+	name   string
+	format func(BypassList) (string, error)
+	parse  func(string) BypassList
+}{
+	{"gnome", func(l BypassList) (string, error) {
+		items, err := l.GNOME()
+		return strings.Join(items, ","), err
+	}, func(s string) BypassList { return parseNativeBypass(strings.Split(s, ",")) }},
+	{"kde", BypassList.KDE, func(s string) BypassList { return parseNativeBypass(strings.Split(s, ",")) }},
+	{"env", BypassList.Env, func(s string) BypassList { return parseNativeBypass(strings.Split(s, ",")) }},
+	{"windows", BypassList.Windows, func(s string) BypassList { return parseNativeBypass(strings.Split(s, ";")) }},
+	{"networksetup", func(l BypassList) (string, error) {
+		items, err := l.Networksetup()
+		return strings.Join(items, " "), err
+	}, func(s string) BypassList { return parseNativeBypass(strings.Fields(s)) }},
+	{"pac", func(l BypassList) (string, error) {
+		items, err := l.Pac()
+		return strings.Join(items, " || "), err
+	}, func(s string) BypassList {
+		script := pacHeader + "\nfunction FindProxyForURL(url, host) {\n\tif (" + s + ") return \"DIRECT\";\n\treturn \"DIRECT\";\n}\n"
+		config, _ := parsePac(script)
+		return splitBypass(config.Proxy.Bypass)
+	}},
+}
+
+func TestBypassFormats(t *testing.T) {
+	// want 为各后端的格式，"error" 表示后端无法表示；back 为读取后与输入不同的结果
+	for _, tt := range []struct {
+		input string
+		want  map[string]string
+		back  map[string]string
+	}{
+		{
+			input: "<local>",
+			want: map[string]string{
+				"gnome": "error", "kde": "error", "env": "error", "windows": "<local>",
+				"networksetup": "error", "pac": "isPlainHostName(host)",
+			},
+		},
+		{
+			input: ".example.com",
+			want: map[string]string{
+				"gnome": "*.example.com", "kde": ".example.com", "env": ".example.com", "windows": "*.example.com",
+				"networksetup": "*.example.com", "pac": `shExpMatch(host, "*.example.com")`,
+			},
+		},
+		{
+			input: "www.*.com",
+			want: map[string]string{
+				"gnome": "error", "kde": "error", "env": "error", "windows": "www.*.com",
+				"networksetup": "www.*.com", "pac": `shExpMatch(host, "www.*.com")`,
+			},
+		},
+		{
+			input: "*",
+			want: map[string]string{
+				"gnome": "error", "kde": "error", "env": "*", "windows": "*",
+				"networksetup": "*", "pac": `shExpMatch(host, "*")`,
+			},
+		},
+		{
+			input: "10.0.0.0/8,192.168.1.0/24",
+			want: map[string]string{
+				"gnome": "10.0.0.0/8,192.168.1.0/24", "kde": "10.0.0.0/8,192.168.1.0/24", "env": "10.0.0.0/8,192.168.1.0/24",
+				"windows": "10.*;192.168.1.*", "networksetup": "10.0.0.0/8 192.168.1.0/24",
+				"pac": `isInNet(host, "10.0.0.0", "255.0.0.0") || isInNet(host, "192.168.1.0", "255.255.255.0")`,
+			},
+			back: map[string]string{"windows": "10.*,192.168.1.*"},
+		},
+		{
+			input: "10.1.2.0/23",
+			want: map[string]string{
+				"gnome": "10.1.2.0/23", "kde": "10.1.2.0/23", "env": "10.1.2.0/23", "windows": "error",
+				"networksetup": "10.1.2.0/23", "pac": `isInNet(host, "10.1.2.0", "255.255.254.0")`,
+			},
+		},
+		{
+			input: "[::1],2001:db8::1",
+			want: map[string]string{
+				"gnome": "::1,2001:db8::1", "kde": "::1,2001:db8::1", "env": "::1,2001:db8::1", "windows": "::1;2001:db8::1",
+				"networksetup": "::1 2001:db8::1", "pac": `shExpMatch(host, "::1") || shExpMatch(host, "2001:db8::1")`,
+			},
+		},
+		{
+			input: "fd00::/8",
+			want: map[string]string{
+				"gnome": "fd00::/8", "kde": "fd00::/8", "env": "fd00::/8", "windows": "error",
+				"networksetup": "fd00::/8", "pac": "error",
+			},
+		},
+	} {
+		list, err := ParseBypass(tt.input)
+		if err != nil {
+			t.Fatalf("ParseBypass(%q) error = %v", tt.input, err)
+		}
+		for _, backend := range bypassBackends {
+			got, err := backend.format(list)
+			if want := tt.want[backend.name]; want == "error" {
+				if err == nil || !strings.Contains(err.Error(), "不支持例外地址") {
+					t.Errorf("%s(%q) error = %v, want 不支持例外地址", backend.name, tt.input, err)
+				}
+				continue
+			} else if err != nil || got != want {
+				t.Errorf("%s(%q) = %q, %v, want %q", backend.name, tt.input, got, err, want)
+				continue
+			}
+
+			want := list.String()
+			if back, ok := tt.back[backend.name]; ok {
+				want = back
+			}
+			if back := backend.parse(got).String(); back != want {
+				t.Errorf("%s 读取 %q = %q, want %q", backend.name, got, back, want)
+			}
+		}
+	}
+}
+
+// 读取自后端的无效项原样保留，写回时不报错，PAC 无法表示时报错
+func TestBypassNativeItems(t *testing.T) {
+	list := parseNativeBypass([]string{"192.168.*", " Intranet ", "bad$host", ""})
+	if want := "192.168.*,intranet,bad$host"; list.String() != want {
+		t.Fatalf("parseNativeBypass() = %q, want %q", list, want)
+	}
+	if got, err := list.Windows(); err != nil || got != "192.168.*;intranet;bad$host" {
+		t.Errorf("Windows() = %q, %v", got, err)
+	}
+	if got, err := list.Networksetup(); err != nil || strings.Join(got, " ") != "192.168.* intranet bad$host" {
+		t.Errorf("Networksetup() = %q, %v", got, err)
+	}
+	if _, err := list.Pac(); err == nil {
+		t.Error("Pac() 未拒绝无效的例外地址")
+	}
+}
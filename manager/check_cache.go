@@ -0,0 +1,311 @@
+package manager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sparkle-service/config"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/metacubex/bbolt"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	checkCacheBucket     = "config-check"
+	checkCacheMaxEntries = 128
+	checkCacheFailureTTL = 10 * time.Minute
+	coreVersionTimeout   = 5 * time.Second
+)
+
+type checkResult struct {
+	OK        bool      `json:"ok"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type binaryInfo struct {
+	size    int64
+	modTime time.Time
+	hash    string
+	version string
+}
+
+var (
+	cacheDB     *bbolt.DB
+	cacheDBErr  error
+	cacheDBOnce sync.Once
+
+	binaryMutex sync.Mutex
+	binaryCache = map[string]binaryInfo{}
+
+	fileMutex sync.Mutex
+	fileCache = map[string]fileInfo{}
+)
+
+type fileInfo struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// geodataFiles 为核心从工作目录读取的地理数据文件
+var geodataFiles = []string{
+	"country.mmdb", "Country.mmdb", "geoip.metadb", "GeoLite2-ASN.mmdb",
+	"geoip.dat", "GeoIP.dat", "geosite.dat", "GeoSite.dat",
+}
+
+func openCacheDB() (*bbolt.DB, error) {
+	cacheDBOnce.Do(func() {
+		cacheDB, cacheDBErr = bbolt.Open(config.GetCacheFile(), 0o600, &bbolt.Options{Timeout: time.Second})
+		if cacheDBErr != nil {
+			cacheDBErr = fmt.Errorf("打开缓存数据库失败: %w", cacheDBErr)
+			return
+		}
+		cacheDBErr = cacheDB.Update(func(tx *bbolt.Tx) error {
+			for _, name := range []string{checkCacheBucket, proxySnapshotBucket, proxyTargetBucket, pacBucket} {
+				if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	return cacheDB, cacheDBErr
+}
+
+// checkCacheKey 由配置内容、核心二进制哈希与版本，以及配置引用的本地文件共同组成
+func checkCacheKey(data []byte, binPath string) (string, error) {
+	bin, err := inspectBinary(binPath)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(data)
+	h.Write([]byte{0})
+	h.Write([]byte(bin.hash))
+	h.Write([]byte{0})
+	h.Write([]byte(bin.version))
+	for _, path := range referencedFiles(data) {
+		digest, err := fileDigest(path)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte{0})
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+		h.Write([]byte(digest))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// referencedFiles 返回代理集合与规则集合的本地文件，以及工作目录中的地理数据文件
+func referencedFiles(data []byte) []string {
+	workDir := config.GetWorkDir()
+	var files []string
+
+	var conf map[string]any
+	if err := yaml.Unmarshal(data, &conf); err == nil {
+		for _, key := range []string{"proxy-providers", "rule-providers"} {
+			providers, _ := conf[key].(map[string]any)
+			for _, provider := range providers {
+				provider, _ := provider.(map[string]any)
+				path, _ := provider["path"].(string)
+				if path == "" {
+					continue
+				}
+				if !filepath.IsAbs(path) {
+					path = filepath.Join(workDir, path)
+				}
+				files = append(files, path)
+			}
+		}
+	}
+	if workDir != "" {
+		for _, name := range geodataFiles {
+			files = append(files, filepath.Join(workDir, name))
+		}
+	}
+
+	sort.Strings(files)
+	return files
+}
+
+// fileDigest 计算文件哈希，文件未变化时复用上次结果，文件不存在时返回空
+func fileDigest(path string) (string, error) {
+	stat, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && stat.IsDir() {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("读取文件 %s 失败: %w", path, err)
+	}
+
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	if info, ok := fileCache[path]; ok && info.size == stat.Size() && info.modTime.Equal(stat.ModTime()) {
+		return info.hash, nil
+	}
+	hash, err := hashFile(path)
+	if err != nil {
+		return "", fmt.Errorf("读取文件 %s 失败: %w", path, err)
+	}
+	fileCache[path] = fileInfo{size: stat.Size(), modTime: stat.ModTime(), hash: hash}
+	return hash, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// inspectBinary 计算核心二进制的哈希与版本，文件未变化时复用上次结果
+func inspectBinary(path string) (binaryInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return binaryInfo{}, fmt.Errorf("读取核心文件失败: %w", err)
+	}
+
+	binaryMutex.Lock()
+	defer binaryMutex.Unlock()
+
+	if info, ok := binaryCache[path]; ok && info.size == stat.Size() && info.modTime.Equal(stat.ModTime()) {
+		return info, nil
+	}
+
+	hash, err := hashFile(path)
+	if err != nil {
+		return binaryInfo{}, fmt.Errorf("计算核心哈希失败: %w", err)
+	}
+
+	info := binaryInfo{
+		size:    stat.Size(),
+		modTime: stat.ModTime(),
+		hash:    hash,
+		version: coreVersion(path),
+	}
+	binaryCache[path] = info
+	return info, nil
+}
+
+func coreVersion(path string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), coreVersionTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, path, "-v").Output()
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimSpace(line)
+}
+
+func loadCheckResult(key string) (*checkResult, bool) {
+	db, err := openCacheDB()
+	if err != nil {
+		return nil, false
+	}
+
+	var result checkResult
+	found := false
+	_ = db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte(checkCacheBucket)).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return err
+		}
+		found = true
+		return nil
+	})
+	if !found {
+		return nil, false
+	}
+	if !result.OK && time.Since(result.CheckedAt) > checkCacheFailureTTL {
+		return nil, false
+	}
+	return &result, true
+}
+
+func storeCheckResult(key string, checkErr error) error {
+	db, err := openCacheDB()
+	if err != nil {
+		return err
+	}
+
+	result := checkResult{
+		OK:        checkErr == nil,
+		CheckedAt: time.Now(),
+	}
+	if checkErr != nil {
+		result.Error = checkErr.Error()
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(checkCacheBucket))
+		if err := bucket.Put([]byte(key), data); err != nil {
+			return err
+		}
+		return evictCheckResults(bucket)
+	})
+}
+
+// evictCheckResults 超出容量时删除最早的检查结果
+func evictCheckResults(bucket *bbolt.Bucket) error {
+	type entry struct {
+		key       []byte
+		checkedAt time.Time
+	}
+
+	var entries []entry
+	if err := bucket.ForEach(func(k, v []byte) error {
+		var result checkResult
+		if err := json.Unmarshal(v, &result); err != nil {
+			result.CheckedAt = time.Time{}
+		}
+		entries = append(entries, entry{key: append([]byte(nil), k...), checkedAt: result.CheckedAt})
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for len(entries) > checkCacheMaxEntries {
+		oldest := 0
+		for i := range entries {
+			if entries[i].checkedAt.Before(entries[oldest].checkedAt) {
+				oldest = i
+			}
+		}
+		if err := bucket.Delete(entries[oldest].key); err != nil {
+			return err
+		}
+		entries = append(entries[:oldest], entries[oldest+1:]...)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"sparkle-service/config"
+	"testing"
+)
+
+// 配置引用的规则集合与工作目录中的地理数据变化时缓存失效
+func TestCheckCacheKeyReferencedFiles(t *testing.T) {
+	ruleSet := filepath.Join(t.TempDir(), "rules.yaml")
+	data := []byte("rule-providers:\n  local: {type: file, behavior: domain, path: " + ruleSet + "}\n")
+
+	key := func() string {
+		t.Helper()
+		key, err := checkCacheKey(data, coreBinaryPath())
+		if err != nil {
+			t.Fatalf("checkCacheKey() error = %v", err)
+		}
+		return key
+	}
+
+	missing := key()
+	if err := os.WriteFile(ruleSet, []byte("payload:\n  - example.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	written := key()
+	if written == missing {
+		t.Error("规则集合创建后缓存键未变化")
+	}
+	if err := os.WriteFile(ruleSet, []byte("payload:\n  - example.org\n  - example.net\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed := key()
+	if changed == written {
+		t.Error("规则集合修改后缓存键未变化")
+	}
+
+	geoip := filepath.Join(config.GetWorkDir(), "geoip.dat")
+	if err := os.WriteFile(geoip, []byte("geoip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(geoip)
+	if key() == changed {
+		t.Error("地理数据创建后缓存键未变化")
+	}
+}
+
+// 只缓存配置本身的错误，临时失败重新测试
+func TestConfigCheckCachesOnlyInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		config string
+		cached bool
+	}{
+		{"rules:\n  - MATCH,DIRECT\n", true},
+		{"x-fatal: 配置无效\n", true},
+		{"x-broken-proxy: true\n", false},
+	} {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(tt.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		checkErr := ConfigCheck(path, true)
+
+		key, err := checkCacheKey([]byte(tt.config), coreBinaryPath())
+		if err != nil {
+			t.Fatalf("checkCacheKey() error = %v", err)
+		}
+		result, cached := loadCheckResult(key)
+		if cached != tt.cached {
+			t.Errorf("ConfigCheck(%q) = %v, cached = %v, want %v", tt.config, checkErr, cached, tt.cached)
+		}
+		if cached && result.OK != (checkErr == nil) {
+			t.Errorf("ConfigCheck(%q) = %v, cached ok = %v", tt.config, checkErr, result.OK)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"sparkle-service/config"
+	"sparkle-service/manager/sandbox"
+	"sync"
+)
+
+const defaultCheckParallelism = 2
+
+var (
+	checkPool     *sandbox.Pool
+	checkPoolOnce sync.Once
+	checkLimiter  = newParallelLimiter()
+)
+
+// sandboxPool 按当前设置返回沙盒池，未启用时返回 nil
+func sandboxPool() *sandbox.Pool {
+	size := config.GetSandboxPool()
+	checkPoolOnce.Do(func() {
+		checkPool = sandbox.NewPool(size)
+	})
+	checkPool.Resize(size)
+	if size <= 0 {
+		return nil
+	}
+	return checkPool
+}
+
+// WarmSandboxPool 按设置预创建沙盒根目录
+func WarmSandboxPool() {
+	if pool := sandboxPool(); pool != nil {
+		pool.Warm(sandbox.Config{
+			BinaryPath: coreBinaryPath(),
+			WorkDir:    config.GetWorkDir(),
+		})
+	}
+}
+
+func checkParallelism() int {
+	if n := config.GetCheckParallelism(); n > 0 {
+		return n
+	}
+	return defaultCheckParallelism
+}
+
+// parallelLimiter 限制同时运行的任务数量，上限在每次获取时读取以便动态调整
+type parallelLimiter struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	running int
+}
+
+func newParallelLimiter() *parallelLimiter {
+	l := &parallelLimiter{}
+	l.cond = sync.NewCond(&l.mutex)
+	return l
+}
+
+func (l *parallelLimiter) acquire(limit int) {
+	l.mutex.Lock()
+	for l.running >= limit {
+		l.cond.Wait()
+	}
+	l.running++
+	l.mutex.Unlock()
+}
+
+func (l *parallelLimiter) release() {
+	l.mutex.Lock()
+	l.running--
+	l.mutex.Unlock()
+	l.cond.Broadcast()
+}
@@ -0,0 +1,287 @@
+package manager
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	applyNone      = "none"
+	applyHotReload = "hot-reload"
+	applyRestart   = "restart"
+
+	maxRuleDiffSize = 2000
+)
+
+var portKeys = []string{"port", "socks-port", "mixed-port", "redir-port", "tproxy-port"}
+
+// 修改后需要重启核心才能生效的顶层配置
+var restartKeys = map[string]bool{
+	"external-controller":      true,
+	"external-controller-tls":  true,
+	"external-controller-unix": true,
+	"external-controller-pipe": true,
+	"external-ui":              true,
+	"secret":                   true,
+	"geodata-mode":             true,
+	"geodata-loader":           true,
+}
+
+// 已单独比较的顶层配置
+var diffSections = map[string]bool{
+	"proxies":      true,
+	"proxy-groups": true,
+	"rules":        true,
+	"dns":          true,
+	"tun":          true,
+	"listeners":    true,
+}
+
+type DiffRequest struct {
+	Config   string `json:"config"`
+	Path     string `json:"path"`
+	BasePath string `json:"base_path"`
+}
+
+type NamedChange struct {
+	Name   string   `json:"name"`
+	Change string   `json:"change"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+type RuleChange struct {
+	Change string `json:"change"`
+	Index  int    `json:"index"`
+	Rule   string `json:"rule"`
+}
+
+type ConfigDiff struct {
+	Proxies   []NamedChange `json:"proxies"`
+	Groups    []NamedChange `json:"groups"`
+	Rules     []RuleChange  `json:"rules"`
+	DNS       []string      `json:"dns"`
+	TUN       []string      `json:"tun"`
+	Listeners []string      `json:"listeners"`
+	Other     []string      `json:"other"`
+	Apply     string        `json:"apply"`
+	Reasons   []string      `json:"reasons"`
+}
+
+// DiffConfig 比较当前配置与候选配置，并判断变更能否热重载
+func DiffConfig(req DiffRequest) (*ConfigDiff, error) {
+	basePath := req.BasePath
+	if basePath == "" {
+		basePath = activeConfigPath()
+	}
+	baseData, err := readConfigSource("", basePath)
+	if err != nil {
+		return nil, err
+	}
+	if req.Config == "" && req.Path == "" {
+		return nil, fmt.Errorf("候选配置不能为空")
+	}
+	candidateData, err := readConfigSource(req.Config, req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var base, candidate map[string]any
+	if err := yaml.Unmarshal(baseData, &base); err != nil {
+		return nil, fmt.Errorf("解析当前配置失败: %v", err)
+	}
+	if err := yaml.Unmarshal(candidateData, &candidate); err != nil {
+		return nil, fmt.Errorf("解析候选配置失败: %v", err)
+	}
+	if base == nil {
+		base = map[string]any{}
+	}
+	if candidate == nil {
+		candidate = map[string]any{}
+	}
+
+	diff := &ConfigDiff{
+		Proxies:   diffNamed(get(base, "proxies"), get(candidate, "proxies")),
+		Groups:    diffNamed(get(base, "proxy-groups"), get(candidate, "proxy-groups")),
+		Rules:     diffRules(get(base, "rules"), get(candidate, "rules")),
+		DNS:       diffKeys(section(base, "dns"), section(candidate, "dns")),
+		TUN:       diffKeys(section(base, "tun"), section(candidate, "tun")),
+		Listeners: diffListeners(base, candidate),
+		Reasons:   []string{},
+	}
+
+	for _, key := range diffKeys(base, candidate) {
+		if diffSections[key] || slices.Contains(portKeys, key) {
+			continue
+		}
+		diff.Other = append(diff.Other, key)
+		if restartKeys[key] {
+			diff.Reasons = append(diff.Reasons, fmt.Sprintf("%s 变更需要重启核心", key))
+		}
+	}
+	if diff.Other == nil {
+		diff.Other = []string{}
+	}
+
+	switch {
+	case len(diff.Reasons) > 0:
+		diff.Apply = applyRestart
+	case len(diff.Proxies)+len(diff.Groups)+len(diff.Rules)+len(diff.DNS)+len(diff.TUN)+len(diff.Listeners)+len(diff.Other) > 0:
+		diff.Apply = applyHotReload
+	default:
+		diff.Apply = applyNone
+	}
+	return diff, nil
+}
+
+func section(conf map[string]any, name string) map[string]any {
+	if m, ok := conf[name].(map[string]any); ok {
+		return m
+	}
+	return map[string]any{}
+}
+
+// diffKeys 返回两个映射中值不同的键
+func diffKeys(a, b map[string]any) []string {
+	keys := []string{}
+	for k, v := range a {
+		if !reflect.DeepEqual(v, b[k]) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func indexByName(items []any) ([]string, map[string]map[string]any) {
+	var names []string
+	byName := map[string]map[string]any{}
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _ := m["name"].(string)
+		if _, dup := byName[name]; dup {
+			continue
+		}
+		names = append(names, name)
+		byName[name] = m
+	}
+	return names, byName
+}
+
+// diffNamed 按名称比较代理或代理组
+func diffNamed(a, b []any) []NamedChange {
+	aNames, aByName := indexByName(a)
+	bNames, bByName := indexByName(b)
+
+	changes := []NamedChange{}
+	for _, name := range aNames {
+		newItem, ok := bByName[name]
+		if !ok {
+			changes = append(changes, NamedChange{Name: name, Change: "removed"})
+			continue
+		}
+		if fields := diffKeys(aByName[name], newItem); len(fields) > 0 {
+			changes = append(changes, NamedChange{Name: name, Change: "modified", Fields: fields})
+		}
+	}
+	for _, name := range bNames {
+		if _, ok := aByName[name]; !ok {
+			changes = append(changes, NamedChange{Name: name, Change: "added"})
+		}
+	}
+	return changes
+}
+
+// diffRules 按顺序比较规则，返回删除与新增的规则及其位置
+func diffRules(a, b []any) []RuleChange {
+	oldRules := ruleStrings(a)
+	newRules := ruleStrings(b)
+
+	prefix := 0
+	for prefix < len(oldRules) && prefix < len(newRules) && oldRules[prefix] == newRules[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldRules)-prefix && suffix < len(newRules)-prefix &&
+		oldRules[len(oldRules)-1-suffix] == newRules[len(newRules)-1-suffix] {
+		suffix++
+	}
+
+	oldMid := oldRules[prefix : len(oldRules)-suffix]
+	newMid := newRules[prefix : len(newRules)-suffix]
+
+	changes := []RuleChange{}
+	if len(oldMid) > maxRuleDiffSize || len(newMid) > maxRuleDiffSize {
+		for i, rule := range oldMid {
+			changes = append(changes, RuleChange{Change: "removed", Index: prefix + i, Rule: rule})
+		}
+		for i, rule := range newMid {
+			changes = append(changes, RuleChange{Change: "added", Index: prefix + i, Rule: rule})
+		}
+		return changes
+	}
+
+	// 最长公共子序列，未在其中的规则视为删除或新增
+	lcs := make([][]int, len(oldMid)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newMid)+1)
+	}
+	for i := len(oldMid) - 1; i >= 0; i-- {
+		for j := len(newMid) - 1; j >= 0; j-- {
+			if oldMid[i] == newMid[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(oldMid) || j < len(newMid) {
+		switch {
+		case i < len(oldMid) && j < len(newMid) && oldMid[i] == newMid[j]:
+			i++
+			j++
+		case j < len(newMid) && (i == len(oldMid) || lcs[i][j+1] >= lcs[i+1][j]):
+			changes = append(changes, RuleChange{Change: "added", Index: prefix + j, Rule: newMid[j]})
+			j++
+		default:
+			changes = append(changes, RuleChange{Change: "removed", Index: prefix + i, Rule: oldMid[i]})
+			i++
+		}
+	}
+	return changes
+}
+
+func ruleStrings(items []any) []string {
+	rules := make([]string, 0, len(items))
+	for _, item := range items {
+		rules = append(rules, fmt.Sprint(item))
+	}
+	return rules
+}
+
+// diffListeners 比较入站端口与 listeners
+func diffListeners(base, candidate map[string]any) []string {
+	changes := []string{}
+	for _, key := range portKeys {
+		if !reflect.DeepEqual(base[key], candidate[key]) {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", key, base[key], candidate[key]))
+		}
+	}
+	for _, c := range diffNamed(get(base, "listeners"), get(candidate, "listeners")) {
+		changes = append(changes, fmt.Sprintf("listener %s: %s", c.Name, c.Change))
+	}
+	return changes
+}
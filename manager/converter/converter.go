@@ -0,0 +1,206 @@
+package converter
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type LinkError struct {
+	Line  int    `json:"line"`
+	Link  string `json:"link"`
+	Error string `json:"error"`
+}
+
+// Result 为转换后的代理列表及逐条链接的错误
+type Result struct {
+	Proxies []map[string]any `json:"proxies"`
+	Errors  []LinkError      `json:"errors"`
+}
+
+type parser func(link string) (map[string]any, error)
+
+var parsers = map[string]parser{
+	"ss":        parseShadowsocks,
+	"vmess":     parseVmess,
+	"vless":     parseVless,
+	"trojan":    parseTrojan,
+	"hysteria2": parseHysteria2,
+	"hy2":       parseHysteria2,
+	"tuic":      parseTuic,
+}
+
+// Convert 解析订阅内容，支持 base64 编码的内容或逐行的分享链接
+func Convert(content string) Result {
+	result := Result{
+		Proxies: []map[string]any{},
+		Errors:  []LinkError{},
+	}
+	names := map[string]int{}
+
+	for i, line := range strings.Split(decodeSubscription(content), "\n") {
+		link := strings.TrimSpace(line)
+		if link == "" || strings.HasPrefix(link, "#") {
+			continue
+		}
+
+		proxy, err := ParseLink(link)
+		if err != nil {
+			result.Errors = append(result.Errors, LinkError{Line: i + 1, Link: link, Error: err.Error()})
+			continue
+		}
+
+		name := proxy["name"].(string)
+		if n := names[name]; n > 0 {
+			proxy["name"] = fmt.Sprintf("%s %d", name, n+1)
+		}
+		names[name]++
+
+		result.Proxies = append(result.Proxies, proxy)
+	}
+	return result
+}
+
+// ParseLink 解析单条分享链接为 mihomo 代理配置
+func ParseLink(link string) (map[string]any, error) {
+	scheme, _, ok := strings.Cut(link, "://")
+	if !ok {
+		return nil, fmt.Errorf("无效的分享链接")
+	}
+	parse, ok := parsers[strings.ToLower(scheme)]
+	if !ok {
+		return nil, fmt.Errorf("不支持的协议: %s", scheme)
+	}
+
+	proxy, err := parse(link)
+	if err != nil {
+		return nil, err
+	}
+	if name, _ := proxy["name"].(string); name == "" {
+		proxy["name"] = fmt.Sprintf("%s %s:%v", proxy["type"], proxy["server"], proxy["port"])
+	}
+	return proxy, nil
+}
+
+func decodeSubscription(content string) string {
+	content = strings.TrimSpace(content)
+	if strings.Contains(content, "://") {
+		return content
+	}
+	if decoded, err := decodeBase64(strings.Join(strings.Fields(content), "")); err == nil {
+		return string(decoded)
+	}
+	return content
+}
+
+// decodeBase64 兼容标准与 URL 编码，以及是否带填充
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	encodings := []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	}
+	var lastErr error
+	for _, enc := range encodings {
+		data, err := enc.DecodeString(s)
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// BuildConfig 按模板生成完整配置，template 为空时使用 default 模板
+func BuildConfig(proxies []map[string]any, template, templateContent string) ([]byte, error) {
+	var conf map[string]any
+	if templateContent != "" {
+		if err := yaml.Unmarshal([]byte(templateContent), &conf); err != nil {
+			return nil, fmt.Errorf("解析模板失败: %v", err)
+		}
+		if conf == nil {
+			conf = map[string]any{}
+		}
+	} else {
+		if template == "" {
+			template = "default"
+		}
+		build, ok := templates[template]
+		if !ok {
+			return nil, fmt.Errorf("未知的模板: %s", template)
+		}
+		conf = build()
+	}
+
+	names := make([]any, 0, len(proxies))
+	items := make([]any, 0, len(proxies))
+	for _, proxy := range proxies {
+		names = append(names, proxy["name"])
+		items = append(items, proxy)
+	}
+	conf["proxies"] = items
+	if len(names) == 0 {
+		names = append(names, "DIRECT")
+	}
+
+	// 模板中未列出成员的代理组填入全部代理
+	if groups, ok := conf["proxy-groups"].([]any); ok {
+		for _, item := range groups {
+			group, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			if _, hasUse := group["use"]; hasUse {
+				continue
+			}
+			if members, _ := group["proxies"].([]any); len(members) == 0 {
+				group["proxies"] = names
+			}
+		}
+	}
+
+	return yaml.Marshal(conf)
+}
+
+// Proxies 将代理列表序列化为仅包含 proxies 的 YAML
+func Proxies(proxies []map[string]any) ([]byte, error) {
+	return yaml.Marshal(map[string]any{"proxies": proxies})
+}
+
+var templates = map[string]func() map[string]any{
+	"default": func() map[string]any {
+		return map[string]any{
+			"mixed-port": 7890,
+			"allow-lan":  false,
+			"mode":       "rule",
+			"log-level":  "info",
+			"proxy-groups": []any{
+				map[string]any{"name": "PROXY", "type": "select", "proxies": []any{}},
+			},
+			"rules": []any{"MATCH,PROXY"},
+		}
+	},
+	"url-test": func() map[string]any {
+		return map[string]any{
+			"mixed-port": 7890,
+			"allow-lan":  false,
+			"mode":       "rule",
+			"log-level":  "info",
+			"proxy-groups": []any{
+				map[string]any{"name": "PROXY", "type": "select", "proxies": []any{"AUTO", "DIRECT"}},
+				map[string]any{
+					"name":     "AUTO",
+					"type":     "url-test",
+					"url":      "https://www.gstatic.com/generate_204",
+					"interval": 300,
+					"proxies":  []any{},
+				},
+			},
+			"rules": []any{"MATCH,PROXY"},
+		}
+	},
+}
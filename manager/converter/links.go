@@ -0,0 +1,402 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func parseShadowsocks(link string) (map[string]any, error) {
+	// 旧格式将 method:password@host:port 整体 base64 编码
+	body, name, _ := strings.Cut(strings.TrimPrefix(link, "ss://"), "#")
+	if !strings.Contains(body, "@") {
+		decoded, err := decodeBase64(body)
+		if err != nil {
+			return nil, fmt.Errorf("解码 ss 链接失败: %v", err)
+		}
+		link = "ss://" + string(decoded) + "#" + name
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("解析 ss 链接失败: %v", err)
+	}
+
+	var method, password string
+	if p, ok := u.User.Password(); ok {
+		method, password = u.User.Username(), p
+	} else {
+		decoded, err := decodeBase64(u.User.Username())
+		if err != nil {
+			return nil, fmt.Errorf("解码 ss 用户信息失败: %v", err)
+		}
+		var found bool
+		if method, password, found = strings.Cut(string(decoded), ":"); !found {
+			return nil, fmt.Errorf("无效的 ss 用户信息")
+		}
+	}
+
+	proxy, err := newProxy("ss", u)
+	if err != nil {
+		return nil, err
+	}
+	proxy["cipher"] = method
+	proxy["password"] = password
+	proxy["udp"] = true
+
+	if plugin := parseQuery(u.RawQuery).Get("plugin"); plugin != "" {
+		if err := applySSPlugin(proxy, plugin); err != nil {
+			return nil, err
+		}
+	}
+	return proxy, nil
+}
+
+// applySSPlugin 转换 SIP003 插件参数，如 obfs-local;obfs=http;obfs-host=example.com
+func applySSPlugin(proxy map[string]any, plugin string) error {
+	parts := strings.Split(plugin, ";")
+	opts := map[string]string{}
+	for _, part := range parts[1:] {
+		key, value, _ := strings.Cut(part, "=")
+		opts[key] = value
+	}
+
+	switch parts[0] {
+	case "obfs-local", "simple-obfs":
+		proxy["plugin"] = "obfs"
+		proxy["plugin-opts"] = map[string]any{
+			"mode": opts["obfs"],
+			"host": opts["obfs-host"],
+		}
+	case "v2ray-plugin":
+		pluginOpts := map[string]any{
+			"mode": "websocket",
+			"host": opts["host"],
+			"path": opts["path"],
+		}
+		if _, ok := opts["tls"]; ok {
+			pluginOpts["tls"] = true
+		}
+		proxy["plugin"] = "v2ray-plugin"
+		proxy["plugin-opts"] = pluginOpts
+	default:
+		return fmt.Errorf("不支持的 ss 插件: %s", parts[0])
+	}
+	return nil
+}
+
+type vmessLink struct {
+	Ps   string          `json:"ps"`
+	Add  string          `json:"add"`
+	Port json.RawMessage `json:"port"`
+	ID   string          `json:"id"`
+	Aid  json.RawMessage `json:"aid"`
+	Scy  string          `json:"scy"`
+	Net  string          `json:"net"`
+	Type string          `json:"type"`
+	Host string          `json:"host"`
+	Path string          `json:"path"`
+	TLS  string          `json:"tls"`
+	SNI  string          `json:"sni"`
+	ALPN string          `json:"alpn"`
+	FP   string          `json:"fp"`
+}
+
+func parseVmess(link string) (map[string]any, error) {
+	decoded, err := decodeBase64(strings.TrimPrefix(link, "vmess://"))
+	if err != nil {
+		return nil, fmt.Errorf("解码 vmess 链接失败: %v", err)
+	}
+
+	var v vmessLink
+	if err := json.Unmarshal(decoded, &v); err != nil {
+		return nil, fmt.Errorf("解析 vmess 链接失败: %v", err)
+	}
+
+	port, err := jsonInt(v.Port)
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("无效的端口")
+	}
+	if v.Add == "" || v.ID == "" {
+		return nil, fmt.Errorf("vmess 链接缺少服务器或 UUID")
+	}
+	aid, _ := jsonInt(v.Aid)
+
+	cipher := v.Scy
+	if cipher == "" {
+		cipher = "auto"
+	}
+
+	proxy := map[string]any{
+		"name":    v.Ps,
+		"type":    "vmess",
+		"server":  v.Add,
+		"port":    port,
+		"uuid":    v.ID,
+		"alterId": aid,
+		"cipher":  cipher,
+		"udp":     true,
+	}
+	if v.TLS == "tls" {
+		proxy["tls"] = true
+		if v.SNI != "" {
+			proxy["servername"] = v.SNI
+		}
+		if v.ALPN != "" {
+			proxy["alpn"] = strings.Split(v.ALPN, ",")
+		}
+		if v.FP != "" {
+			proxy["client-fingerprint"] = v.FP
+		}
+	}
+
+	network := v.Net
+	if network == "tcp" && v.Type == "http" {
+		network = "http"
+	}
+	applyTransport(proxy, network, v.Host, v.Path, v.Path)
+	return proxy, nil
+}
+
+func parseVless(link string) (map[string]any, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("解析 vless 链接失败: %v", err)
+	}
+	proxy, err := newProxy("vless", u)
+	if err != nil {
+		return nil, err
+	}
+	if u.User.Username() == "" {
+		return nil, fmt.Errorf("vless 链接缺少 UUID")
+	}
+
+	q := parseQuery(u.RawQuery)
+	proxy["uuid"] = u.User.Username()
+	proxy["udp"] = true
+	if flow := q.Get("flow"); flow != "" {
+		proxy["flow"] = flow
+	}
+
+	switch q.Get("security") {
+	case "tls":
+		proxy["tls"] = true
+	case "reality":
+		proxy["tls"] = true
+		proxy["reality-opts"] = map[string]any{
+			"public-key": q.Get("pbk"),
+			"short-id":   q.Get("sid"),
+		}
+	}
+	if sni := q.Get("sni"); sni != "" {
+		proxy["servername"] = sni
+	}
+	applyTLSParams(proxy, q)
+	applyTransport(proxy, q.Get("type"), q.Get("host"), q.Get("path"), q.Get("serviceName"))
+	return proxy, nil
+}
+
+func parseTrojan(link string) (map[string]any, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("解析 trojan 链接失败: %v", err)
+	}
+	proxy, err := newProxy("trojan", u)
+	if err != nil {
+		return nil, err
+	}
+	if u.User.Username() == "" {
+		return nil, fmt.Errorf("trojan 链接缺少密码")
+	}
+
+	q := parseQuery(u.RawQuery)
+	proxy["password"] = u.User.Username()
+	proxy["udp"] = true
+	if sni := q.Get("sni"); sni != "" {
+		proxy["sni"] = sni
+	}
+	applyTLSParams(proxy, q)
+	applyTransport(proxy, q.Get("type"), q.Get("host"), q.Get("path"), q.Get("serviceName"))
+	return proxy, nil
+}
+
+func parseHysteria2(link string) (map[string]any, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("解析 hysteria2 链接失败: %v", err)
+	}
+	proxy, err := newProxy("hysteria2", u)
+	if err != nil {
+		return nil, err
+	}
+
+	q := parseQuery(u.RawQuery)
+	password := u.User.Username()
+	if p, ok := u.User.Password(); ok {
+		password += ":" + p
+	}
+	proxy["password"] = password
+	if sni := q.Get("sni"); sni != "" {
+		proxy["sni"] = sni
+	}
+	if obfs := q.Get("obfs"); obfs != "" && obfs != "none" {
+		proxy["obfs"] = obfs
+		proxy["obfs-password"] = q.Get("obfs-password")
+	}
+	if ports := q.Get("mport"); ports != "" {
+		proxy["ports"] = ports
+	}
+	if pin := q.Get("pinSHA256"); pin != "" {
+		proxy["fingerprint"] = pin
+	}
+	applyTLSParams(proxy, q)
+	return proxy, nil
+}
+
+func parseTuic(link string) (map[string]any, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("解析 tuic 链接失败: %v", err)
+	}
+	proxy, err := newProxy("tuic", u)
+	if err != nil {
+		return nil, err
+	}
+
+	password, ok := u.User.Password()
+	if !ok || u.User.Username() == "" {
+		return nil, fmt.Errorf("tuic 链接缺少 UUID 或密码")
+	}
+
+	q := parseQuery(u.RawQuery)
+	proxy["uuid"] = u.User.Username()
+	proxy["password"] = password
+	if cc := q.Get("congestion_control"); cc != "" {
+		proxy["congestion-controller"] = cc
+	}
+	if mode := q.Get("udp_relay_mode"); mode != "" {
+		proxy["udp-relay-mode"] = mode
+	}
+	if sni := q.Get("sni"); sni != "" {
+		proxy["sni"] = sni
+	}
+	if q.Get("disable_sni") == "1" {
+		proxy["disable-sni"] = true
+	}
+	applyTLSParams(proxy, q)
+	return proxy, nil
+}
+
+// parseQuery 只按 & 拆分查询参数。url.ParseQuery 会丢弃含有分号的参数，
+// 而 SIP002 的 plugin 参数通常未经编码，如 plugin=obfs-local;obfs=http
+func parseQuery(rawQuery string) url.Values {
+	q := url.Values{}
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		q.Add(key, value)
+	}
+	return q
+}
+
+// newProxy 填充链接中通用的名称、服务器与端口
+func newProxy(proxyType string, u *url.URL) (map[string]any, error) {
+	host := u.Hostname()
+	if host == "" {
+		return nil, fmt.Errorf("%s 链接缺少服务器地址", proxyType)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("无效的端口: %s", u.Port())
+	}
+	if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("无效的服务器地址: %s", host)
+	}
+
+	return map[string]any{
+		"name":   u.Fragment,
+		"type":   proxyType,
+		"server": host,
+		"port":   port,
+	}, nil
+}
+
+func applyTLSParams(proxy map[string]any, q url.Values) {
+	if insecure := q.Get("allowInsecure") + q.Get("insecure") + q.Get("allow_insecure"); strings.Contains(insecure, "1") || strings.Contains(insecure, "true") {
+		proxy["skip-cert-verify"] = true
+	}
+	if alpn := q.Get("alpn"); alpn != "" {
+		proxy["alpn"] = strings.Split(alpn, ",")
+	}
+	if fp := q.Get("fp"); fp != "" {
+		proxy["client-fingerprint"] = fp
+	}
+}
+
+func applyTransport(proxy map[string]any, network, host, path, serviceName string) {
+	switch network {
+	case "ws":
+		opts := map[string]any{}
+		if path != "" {
+			opts["path"] = path
+		}
+		if host != "" {
+			opts["headers"] = map[string]any{"Host": host}
+		}
+		proxy["network"] = "ws"
+		proxy["ws-opts"] = opts
+	case "grpc":
+		proxy["network"] = "grpc"
+		proxy["grpc-opts"] = map[string]any{"grpc-service-name": serviceName}
+	case "h2":
+		opts := map[string]any{}
+		if host != "" {
+			opts["host"] = strings.Split(host, ",")
+		}
+		if path != "" {
+			opts["path"] = path
+		}
+		proxy["network"] = "h2"
+		proxy["h2-opts"] = opts
+	case "http":
+		opts := map[string]any{}
+		if path != "" {
+			opts["path"] = []string{path}
+		}
+		if host != "" {
+			opts["headers"] = map[string]any{"Host": strings.Split(host, ",")}
+		}
+		proxy["network"] = "http"
+		proxy["http-opts"] = opts
+	}
+}
+
+// jsonInt 兼容数字与字符串形式的整数
+func jsonInt(raw json.RawMessage) (int, error) {
+	if len(raw) == 0 {
+		return 0, nil
+	}
+	var n int
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, err
+	}
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
@@ -4,13 +4,16 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"sparkle-service/config"
 	"sparkle-service/manager/sandbox"
 	"strings"
 	"time"
@@ -18,8 +21,20 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// ConfigCheck 测试配置
-func ConfigCheck(path string) error {
+// checkTargetRule 使代理测试的请求直连本机的测试服务
+const checkTargetRule = "IP-CIDR,127.0.0.1/32,DIRECT,no-resolve"
+
+// 配置测试与延迟测试中核心进程的资源限制
+var sandboxLimits = sandbox.Limits{
+	MemoryBytes: 512 << 20,
+	CPUTime:     2 * time.Minute,
+	FileSize:    64 << 20,
+	Processes:   256,
+	WallClock:   10 * time.Minute,
+}
+
+// ConfigCheck 测试配置，force 为 true 时忽略缓存的检查结果
+func ConfigCheck(path string, force bool) error {
 	if path == "" {
 		return fmt.Errorf("配置文件路径不能为空")
 	}
@@ -28,36 +43,125 @@ func ConfigCheck(path string) error {
 		return fmt.Errorf("读取配置文件失败: %v", err)
 	}
 
+	key, err := checkCacheKey(data, coreBinaryPath())
+	if err != nil {
+		return err
+	}
+	if !force {
+		if ok, err := cachedCheckResult(key); ok {
+			return err
+		}
+	}
+
+	checkLimiter.acquire(checkParallelism())
+	defer checkLimiter.release()
+
+	// 排队期间相同的配置可能已完成测试
+	if !force {
+		if ok, err := cachedCheckResult(key); ok {
+			return err
+		}
+	}
+
+	checkErr := checkConfig(data)
+	// 只缓存通过与配置本身有误的结果，端口、超时等临时失败重新测试
+	var invalid *errInvalidConfig
+	if checkErr == nil || errors.As(checkErr, &invalid) {
+		if err := storeCheckResult(key, checkErr); err != nil {
+			log.Printf("保存配置检查结果失败: %v", err)
+		}
+	}
+	return checkErr
+}
+
+// errInvalidConfig 表示配置本身有误，与运行环境无关
+type errInvalidConfig struct {
+	reason string
+}
+
+func (e *errInvalidConfig) Error() string {
+	return e.reason
+}
+
+// cachedCheckResult 返回缓存中的检查结果，ok 为 false 表示没有可用的缓存
+func cachedCheckResult(key string) (ok bool, err error) {
+	result, ok := loadCheckResult(key)
+	if !ok {
+		return false, nil
+	}
+	if result.OK {
+		return true, nil
+	}
+	return true, errors.New(result.Error)
+}
+
+// readConfigSource 读取请求中的配置内容，未提供时读取指定路径或当前配置文件
+func readConfigSource(content, path string) ([]byte, error) {
+	if content != "" {
+		return []byte(content), nil
+	}
+
+	if path == "" {
+		path = activeConfigPath()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+	return data, nil
+}
+
+func checkConfig(data []byte) error {
 	s, p, g := randThreeStrings(10)
-	p1, p2, config, err := parseConfig(data, s, p, g)
+	p1, p2, testConfig, err := parseConfig(data, s, p, g)
 	if err != nil {
-		return fmt.Errorf("解析配置文件失败: %v", err)
+		return fmt.Errorf("解析配置文件失败: %w", err)
 	}
 
-	proc, err := startProcess(config)
+	// 支持时在独立网络命名空间中测试，避免配置占用宿主端口或修改路由。
+	// 命名空间中只有回环网卡，需要下载远程资源的配置不隔离
+	isolate := sandbox.NetworkIsolationSupported() && !needsNetwork(data)
+	proc, err := startProcess(testConfig, "config-check", isolate)
 	if err != nil {
 		return fmt.Errorf("进程启动失败: %s", err)
 	}
+	defer proc.Stop()
 
-	if err := runTests(proc, p1, p2, s, p, g); err != nil {
-		return fmt.Errorf("测试失败: %v", err)
+	if p1, err = proc.Forward(p1); err != nil {
+		return fmt.Errorf("端口转发失败: %v", err)
+	}
+	if p2, err = proc.Forward(p2); err != nil {
+		return fmt.Errorf("端口转发失败: %v", err)
 	}
 
-	proc.Stop()
+	if err := runTests(proc, p1, p2, s, p, g); err != nil {
+		return fmt.Errorf("测试失败: %w", err)
+	}
 	return nil
 }
 
-func startProcess(config []byte) (*sandbox.SandboxedProcess, error) {
+func startProcess(content []byte, purpose string, isolateNetwork bool) (*sandbox.SandboxedProcess, error) {
 	proc, err := sandbox.NewSandboxedProcess(sandbox.Config{
-		BinaryPath: "/home/atri/mihomo/mihomo",
-		WorkDir:    "/home/atri/mihomo",
-		Args:       []string{"-config", base64.StdEncoding.EncodeToString(config)},
+		BinaryPath:     coreBinaryPath(),
+		WorkDir:        config.GetWorkDir(),
+		Args:           []string{"-config", base64.StdEncoding.EncodeToString(content)},
+		IsolateNetwork: isolateNetwork,
+		Harden:         true,
+		Limits:         sandboxLimits,
+		Purpose:        purpose,
+		Pool:           sandboxPool(),
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	if h := proc.Hardening(); h.Level != sandbox.HardeningFull {
+		log.Printf("沙盒加固级别: %s %v", h.Level, h.Reasons)
+	}
+
 	if err := proc.Start(); err != nil {
+		// 释放登记、临时目录、cgroup 与网络命名空间
+		proc.Kill()
 		return nil, err
 	}
 
@@ -65,7 +169,7 @@ func startProcess(config []byte) (*sandbox.SandboxedProcess, error) {
 }
 
 func runTests(proc *sandbox.SandboxedProcess, proxyPort, controllerPort int, secret, proxie, group string) error {
-	if err := checkProxy(proc.StdoutBuffer(), proxyPort); err != nil {
+	if err := checkProxy(proc, proxyPort); err != nil {
 		return err
 	}
 
@@ -93,7 +197,7 @@ func runTests(proc *sandbox.SandboxedProcess, proxyPort, controllerPort int, sec
 func parseConfig(data []byte, secret, proxie, group string) (int, int, []byte, error) {
 	var conf map[string]any
 	if err := yaml.Unmarshal(data, &conf); err != nil {
-		return 0, 0, nil, fmt.Errorf("解析配置文件失败: %v", err)
+		return 0, 0, nil, &errInvalidConfig{fmt.Sprintf("解析配置文件失败: %v", err)}
 	}
 
 	if tun, ok := conf["tun"].(map[string]any); ok {
@@ -109,6 +213,8 @@ func parseConfig(data []byte, secret, proxie, group string) (int, int, []byte, e
 	conf["external-controller"] = fmt.Sprintf("127.0.0.1:%d", p2)
 	conf["log-level"] = "info"
 	conf["mode"] = "rule"
+	// 代理测试连接本机的测试服务，优先直连
+	conf["rules"] = append([]any{checkTargetRule}, get(conf, "rules")...)
 	listeners := get(conf, "listeners")
 	conf["listeners"] = append(listeners, map[string]any{
 		"type":   "mixed",
@@ -136,6 +242,23 @@ func parseConfig(data []byte, secret, proxie, group string) (int, int, []byte, e
 	return p1, p2, config, nil
 }
 
+// needsNetwork 判断配置是否包含需要下载的远程代理集合或规则集合
+func needsNetwork(data []byte) bool {
+	var conf map[string]any
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return false
+	}
+	for _, key := range []string{"proxy-providers", "rule-providers"} {
+		providers, _ := conf[key].(map[string]any)
+		for _, provider := range providers {
+			if provider, ok := provider.(map[string]any); ok && provider["type"] == "http" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func get(conf map[string]any, name string) []any {
 	if listeners, ok := conf[name].([]any); ok {
 		return listeners
@@ -173,32 +296,61 @@ func randString(n int) string {
 	return string(b)
 }
 
-func checkProxy(outBuffer *bytes.Buffer, port int) error {
+// checkProxy 通过代理端口访问沙盒中可以连接的本机测试服务，不依赖外部网络，
+// 网络隔离时测试服务位于沙盒的网络命名空间中
+func checkProxy(proc *sandbox.SandboxedProcess, port int) error {
+	if err := waitForReady(proc.StdoutBuffer()); err != nil {
+		return err
+	}
+
+	l, err := proc.Listen()
+	if err != nil {
+		return err
+	}
+	token := randString(16)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, token)
+	})}
+	go server.Serve(l)
+	defer server.Close()
+
+	proxy, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", port))
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(proxy),
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get("http://" + l.Addr().String())
+	if err != nil {
+		return fmt.Errorf("代理测试失败: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != token {
+		return fmt.Errorf("代理测试失败")
+	}
+	return nil
+}
+
+// waitForReady 等待沙盒中的核心完成启动
+func waitForReady(outBuffer *sandbox.OutputBuffer) error {
 	deadline := time.Now().Add(startTimeout)
 
 	for time.Now().Before(deadline) {
 		output := outBuffer.String()
 		if strings.Contains(output, successIndicator) {
-			proxy, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", port))
-			client := &http.Client{
-				Transport: &http.Transport{
-					Proxy: http.ProxyURL(proxy),
-				},
-				CheckRedirect: func(req *http.Request, via []*http.Request) error {
-					return http.ErrUseLastResponse
-				},
-			}
-
-			if _, err := client.Get("http://1.1.1.1"); err == nil && strings.Contains(outBuffer.String(), "1.1.1.1:80") {
-				return nil
-			}
-			return fmt.Errorf("代理测试失败")
+			return nil
 		}
 		if strings.Contains(output, fatalIndicator) {
 			if msgStart := strings.Index(output, "level=fatal msg="); msgStart != -1 {
-				return fmt.Errorf("配置错误: %s", output[msgStart+16:])
+				return &errInvalidConfig{fmt.Sprintf("配置错误: %s", output[msgStart+16:])}
 			}
-			return fmt.Errorf("发生致命错误")
+			return &errInvalidConfig{"发生致命错误"}
 		}
 
 		time.Sleep(checkInterval)
@@ -0,0 +1,43 @@
+package manager
+
+import (
+	"sparkle-service/manager/sandbox"
+	"strings"
+	"testing"
+)
+
+func TestNeedsNetwork(t *testing.T) {
+	for _, tt := range []struct {
+		config string
+		want   bool
+	}{
+		{"rules:\n  - MATCH,DIRECT\n", false},
+		{"proxy-providers:\n  local:\n    type: file\n    path: ./local.yaml\n", false},
+		{"proxy-providers:\n  remote:\n    type: http\n    url: https://example.com/sub\n", true},
+		{"rule-providers:\n  remote:\n    type: http\n    behavior: domain\n    url: https://example.com/rules\n", true},
+	} {
+		if got := needsNetwork([]byte(tt.config)); got != tt.want {
+			t.Errorf("needsNetwork(%q) = %v, want %v", tt.config, got, tt.want)
+		}
+	}
+}
+
+// 网络隔离时代理测试在命名空间中完成，不依赖外部网络
+func TestCheckConfigIsolated(t *testing.T) {
+	if !sandbox.NetworkIsolationSupported() {
+		t.Skip("当前环境不支持网络隔离")
+	}
+	if err := checkConfig([]byte("rules:\n  - MATCH,DIRECT\n")); err != nil {
+		t.Fatalf("checkConfig() error = %v", err)
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	// 远程资源使配置在宿主网络中测试
+	if err := checkConfig([]byte("rule-providers:\n  remote:\n    type: http\n    behavior: domain\n    url: https://example.com/rules\n")); err != nil {
+		t.Fatalf("checkConfig() error = %v", err)
+	}
+	if err := checkConfig([]byte("x-fatal: 配置无效\n")); err == nil || !strings.Contains(err.Error(), "配置无效") {
+		t.Errorf("checkConfig() error = %v, want 配置无效", err)
+	}
+}
@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sparkle-service/config"
+	"sparkle-service/manager/sandbox"
+	"strings"
+	"time"
+)
+
+const (
+	defaultExecTimeout = 60
+	maxExecTimeout     = 600
+)
+
+// 允许在沙盒中执行的核心子命令及其固定的前缀参数，
+// 输入输出文件通过沙盒工作目录下的 io 目录传递
+var execCommands = map[string][]string{
+	"test":                    {"-t", "-d", ".", "-f"},
+	"convert-ruleset":         {"convert-ruleset"},
+	"convert-geo":             {"convert-geo"},
+	"generate-initial-config": {"generate-initial-config"},
+}
+
+type ExecRequest struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Files   map[string][]byte `json:"files"`
+	Outputs []string          `json:"outputs"`
+	Timeout int               `json:"timeout"`
+}
+
+// CoreExec 在沙盒中执行白名单内的核心子命令
+func CoreExec(ctx context.Context, req ExecRequest) (sandbox.Result, error) {
+	prefix, ok := execCommands[req.Command]
+	if !ok {
+		return sandbox.Result{}, fmt.Errorf("不允许的命令: %s", req.Command)
+	}
+	for _, arg := range req.Args {
+		if err := validExecArg(arg); err != nil {
+			return sandbox.Result{}, err
+		}
+	}
+
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	timeout = min(timeout, maxExecTimeout)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	limits := sandboxLimits
+	limits.WallClock = time.Duration(timeout) * time.Second
+
+	return sandbox.Run(ctx, sandbox.Config{
+		BinaryPath:     coreBinaryPath(),
+		WorkDir:        config.GetWorkDir(),
+		Args:           append(append([]string{}, prefix...), req.Args...),
+		IsolateNetwork: sandbox.NetworkIsolationSupported(),
+		Harden:         true,
+		Limits:         limits,
+		Purpose:        "exec:" + req.Command,
+		Files:          req.Files,
+		Outputs:        req.Outputs,
+	})
+}
+
+// validExecArg 参数不能是选项，也不能指向沙盒之外的路径
+func validExecArg(arg string) error {
+	if strings.HasPrefix(arg, "-") {
+		return fmt.Errorf("不允许的参数: %s", arg)
+	}
+	if filepath.IsAbs(arg) || strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, `\`) {
+		return fmt.Errorf("不允许使用绝对路径: %s", arg)
+	}
+	for _, part := range strings.FieldsFunc(arg, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return fmt.Errorf("不允许访问上级目录: %s", arg)
+		}
+	}
+	return nil
+}
@@ -57,6 +57,23 @@ func (cm *CoreManager) getCorePath() string {
 	return filepath.Join(config.GetCoreDir(), config.GetCoreName())
 }
 
+// activeConfigPath 返回核心当前使用的配置文件路径
+func activeConfigPath() string {
+	if config.GetConfigPath() == "" {
+		return filepath.Join(config.GetWorkDir(), "config.yaml")
+	}
+	return config.GetConfigPath()
+}
+
+// coreBinaryPath 返回核心可执行文件的完整路径
+func coreBinaryPath() string {
+	corePath := filepath.Join(config.GetCoreDir(), config.GetCoreName())
+	if runtime.GOOS == "windows" {
+		corePath += ".exe"
+	}
+	return corePath
+}
+
 func (cm *CoreManager) StartCore() error {
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
@@ -76,14 +93,7 @@ func (cm *CoreManager) StartCore() error {
 }
 
 func (cm *CoreManager) startProcess() error {
-	var configPath string
-	if config.GetConfigPath() == "" {
-		configPath = filepath.Join(config.GetWorkDir(), "config.yaml")
-	} else {
-		configPath = config.GetConfigPath()
-	}
-
-	if err := ConfigCheck(configPath); err != nil {
+	if err := ConfigCheck(activeConfigPath(), false); err != nil {
 		cm.isRunning.Store(false)
 		return fmt.Errorf("配置测试失败: %w", err)
 	}
@@ -156,12 +166,8 @@ func (cm *CoreManager) RestartCore() error {
 }
 
 func (cm *CoreManager) buildCommand() *exec.Cmd {
-	corePath := cm.getCorePath()
-	if runtime.GOOS == "windows" {
-		corePath = cm.getCorePath() + ".exe"
-	}
 	cmd := exec.Command(
-		corePath,
+		coreBinaryPath(),
 		"-d", config.GetWorkDir(),
 	)
 	if config.GetConfigPath() != "" {
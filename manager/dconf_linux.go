@@ -0,0 +1,319 @@
+//go:build linux
+
+package manager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// GSettings 的 dconf 后端：读取用户数据库文件，通过会话总线上的 dconf 写入服务一次性提交修改
+const (
+	dconfService      = "ca.desrt.dconf"
+	dconfWriterPath   = "/ca/desrt/dconf/Writer/user"
+	dconfWriterChange = "ca.desrt.dconf.Writer.Change"
+	dconfUserDB       = ".config/dconf/user"
+)
+
+// 已知 schema 在 dconf 中的路径，子 schema 按名称追加路径
+var dconfSchemaPaths = map[string]string{
+	"org.gnome.system.proxy":             "/system/proxy/",
+	"com.deepin.wrap.gnome.system.proxy": "/com/deepin/wrap/gnome/system/proxy/",
+}
+
+// gsetting 为一个 GSettings 键值，value 为 string、int32、bool 或 []string
+type gsetting struct {
+	schema string
+	key    string
+	value  any
+}
+
+func dconfKeyPath(schema, key string) (string, bool) {
+	for base, path := range dconfSchemaPaths {
+		if schema == base {
+			return path + key, true
+		}
+		if rest, ok := strings.CutPrefix(schema, base+"."); ok {
+			return path + strings.ReplaceAll(rest, ".", "/") + "/" + key, true
+		}
+	}
+	return "", false
+}
+
+// readDconf 读取用户 dconf 数据库中的全部键值
+func readDconf(s *Session) (map[string]any, error) {
+	path := filepath.Join(s.homeDir, dconfUserDB)
+	if _, err := os.Lstat(path); err != nil {
+		return nil, fmt.Errorf("dconf 数据库不可用：%v", err)
+	}
+	data, err := readUserFile(s, path)
+	if err != nil {
+		return nil, err
+	}
+	return parseGvdb(data)
+}
+
+// writeDconf 将全部键值作为一个变更集提交给 dconf 写入服务
+func writeDconf(s *Session, settings []gsetting) error {
+	changes := map[string]any{}
+	for _, setting := range settings {
+		path, ok := dconfKeyPath(setting.schema, setting.key)
+		if !ok {
+			return fmt.Errorf("未知的 dconf 路径：%s", setting.schema)
+		}
+		changes[path] = setting.value
+	}
+	blob, err := encodeChangeset(changes)
+	if err != nil {
+		return err
+	}
+
+	conn, err := s.connectBus()
+	if err != nil {
+		return fmt.Errorf("无法连接用户会话总线：%v", err)
+	}
+	defer conn.Close()
+
+	var tag string
+	if err := conn.Object(dconfService, dconfWriterPath).Call(dconfWriterChange, 0, blob).Store(&tag); err != nil {
+		return fmt.Errorf("写入 dconf 失败：%v", err)
+	}
+	return nil
+}
+
+// parseGvdb 解析 GVDB 格式的 dconf 数据库，只保留值类型的条目
+func parseGvdb(data []byte) (map[string]any, error) {
+	le := binary.LittleEndian
+	if len(data) < 24 || string(data[:8]) != "GVariant" {
+		return nil, errors.New("无效的 dconf 数据库")
+	}
+	start, end := uint64(le.Uint32(data[16:])), uint64(le.Uint32(data[20:]))
+	if end > uint64(len(data)) || start+8 > end {
+		return nil, errors.New("无效的 dconf 数据库")
+	}
+	nBloom := uint64(le.Uint32(data[start:]) & (1<<27 - 1))
+	nBuckets := uint64(le.Uint32(data[start+4:]))
+	itemsStart := start + 8 + 4*(nBloom+nBuckets)
+	if itemsStart > end {
+		return nil, errors.New("无效的 dconf 数据库")
+	}
+
+	type item struct {
+		parent     uint32
+		key        string
+		kind       byte
+		start, end uint32
+	}
+	items := make([]item, (end-itemsStart)/24)
+	for i := range items {
+		raw := data[itemsStart+uint64(i)*24:]
+		keyStart, keySize := uint64(le.Uint32(raw[8:])), uint64(le.Uint16(raw[12:]))
+		if keyStart+keySize > uint64(len(data)) {
+			return nil, errors.New("无效的 dconf 数据库")
+		}
+		items[i] = item{
+			parent: le.Uint32(raw[4:]),
+			key:    string(data[keyStart : keyStart+keySize]),
+			kind:   raw[14],
+			start:  le.Uint32(raw[16:]),
+			end:    le.Uint32(raw[20:]),
+		}
+	}
+
+	values := map[string]any{}
+	for _, it := range items {
+		if it.kind != 'v' || it.start > it.end || uint64(it.end) > uint64(len(data)) {
+			continue
+		}
+		name := it.key
+		for parent, depth := it.parent, 0; parent != 0xffffffff; depth++ {
+			if int(parent) >= len(items) || depth > len(items) {
+				return nil, errors.New("无效的 dconf 数据库")
+			}
+			name = items[parent].key + name
+			parent = items[parent].parent
+		}
+		if value, ok := decodeVariant(data[it.start:it.end]); ok {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+// decodeVariant 解码序列化的 v 类型值，只支持代理设置用到的类型
+func decodeVariant(data []byte) (any, bool) {
+	sep := bytes.LastIndexByte(data, 0)
+	if sep < 0 {
+		return nil, false
+	}
+	body := data[:sep]
+	switch string(data[sep+1:]) {
+	case "s":
+		return decodeString(body), true
+	case "b":
+		return len(body) == 1 && body[0] != 0, len(body) == 1
+	case "i":
+		if len(body) != 4 {
+			return nil, false
+		}
+		return int32(binary.LittleEndian.Uint32(body)), true
+	case "as":
+		return decodeStringArray(body)
+	}
+	return nil, false
+}
+
+func decodeString(body []byte) string {
+	if len(body) == 0 || body[len(body)-1] != 0 {
+		return ""
+	}
+	return string(body[:len(body)-1])
+}
+
+func decodeStringArray(body []byte) (any, bool) {
+	items := []string{}
+	if len(body) == 0 {
+		return items, true
+	}
+	width := offsetWidth(len(body))
+	last := readOffset(body[len(body)-width:])
+	if last > len(body) || (len(body)-last)%width != 0 {
+		return nil, false
+	}
+	start := 0
+	for pos := last; pos < len(body); pos += width {
+		end := readOffset(body[pos : pos+width])
+		if end < start || end > last {
+			return nil, false
+		}
+		items = append(items, decodeString(body[start:end]))
+		start = end
+	}
+	return items, true
+}
+
+// encodeChangeset 将键值序列化为 dconf 变更集使用的 a{smv}
+func encodeChangeset(changes map[string]any) ([]byte, error) {
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var (
+		out     []byte
+		offsets []int
+	)
+	for _, key := range keys {
+		body, kind, err := encodeValue(changes[key])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		out = pad(out, 8)
+		entry := append([]byte(key), 0)
+		keyEnd := len(entry)
+		entry = pad(entry, 8)
+		entry = append(entry, body...)
+		entry = append(entry, 0)
+		entry = append(entry, kind...)
+		// maybe 类型的非空值以一个 0 字节结尾
+		entry = append(entry, 0)
+		entry = appendOffsets(entry, []int{keyEnd})
+		out = append(out, entry...)
+		offsets = append(offsets, len(out))
+	}
+	return appendOffsets(out, offsets), nil
+}
+
+func encodeValue(value any) ([]byte, string, error) {
+	switch v := value.(type) {
+	case string:
+		return append([]byte(v), 0), "s", nil
+	case bool:
+		if v {
+			return []byte{1}, "b", nil
+		}
+		return []byte{0}, "b", nil
+	case int32:
+		return binary.LittleEndian.AppendUint32(nil, uint32(v)), "i", nil
+	case []string:
+		var (
+			body    []byte
+			offsets []int
+		)
+		for _, item := range v {
+			body = append(body, item...)
+			body = append(body, 0)
+			offsets = append(offsets, len(body))
+		}
+		return appendOffsets(body, offsets), "as", nil
+	}
+	return nil, "", fmt.Errorf("不支持的类型：%T", value)
+}
+
+func pad(data []byte, align int) []byte {
+	for len(data)%align != 0 {
+		data = append(data, 0)
+	}
+	return data
+}
+
+// offsetWidth 返回容器大小对应的偏移量宽度
+func offsetWidth(size int) int {
+	switch {
+	case size <= 0xff:
+		return 1
+	case size <= 0xffff:
+		return 2
+	}
+	return 4
+}
+
+func appendOffsets(body []byte, offsets []int) []byte {
+	width := 4
+	switch {
+	case len(body)+len(offsets) <= 0xff:
+		width = 1
+	case len(body)+2*len(offsets) <= 0xffff:
+		width = 2
+	}
+	for _, offset := range offsets {
+		for i := 0; i < width; i++ {
+			body = append(body, byte(offset>>(8*i)))
+		}
+	}
+	return body
+}
+
+func readOffset(data []byte) int {
+	offset := 0
+	for i := len(data) - 1; i >= 0; i-- {
+		offset = offset<<8 | int(data[i])
+	}
+	return offset
+}
+
+// formatGVariant 将值格式化为 gsettings 命令行使用的 GVariant 文本
+func formatGVariant(value any) string {
+	switch v := value.(type) {
+	case string:
+		return quoteGVariant(v)
+	case []string:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = quoteGVariant(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
+
+func quoteGVariant(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,98 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// testdata/dconf 由 gen.py 生成：值与变更集由 GLib 序列化，数据库的目录结构经 GLib 的 GVDB 读取器校验
+
+func TestParseGvdb(t *testing.T) {
+	data, err := os.ReadFile("testdata/dconf/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := parseGvdb(data)
+	if err != nil {
+		t.Fatalf("parseGvdb() error = %v", err)
+	}
+
+	// idle-delay 为 uint32，不属于代理设置用到的类型
+	want := map[string]any{
+		"/system/proxy/mode":                           "manual",
+		"/system/proxy/use-same-proxy":                 false,
+		"/system/proxy/ignore-hosts":                   []string{"localhost", "127.0.0.0/8", "::1"},
+		"/system/proxy/autoconfig-url":                 "",
+		"/system/proxy/http/host":                      "127.0.0.1",
+		"/system/proxy/http/port":                      int32(7890),
+		"/system/proxy/https/host":                     "127.0.0.1",
+		"/system/proxy/https/port":                     int32(7890),
+		"/system/proxy/socks/host":                     "127.0.0.1",
+		"/system/proxy/socks/port":                     int32(7891),
+		"/org/gnome/desktop/interface/color-scheme":    "prefer-dark",
+		"/org/gnome/desktop/input-sources/xkb-options": []string{},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("parseGvdb() = %v, want %v", values, want)
+	}
+
+	for _, bad := range [][]byte{nil, data[:24], append([]byte("GVariant"), make([]byte, 16)...)} {
+		if _, err := parseGvdb(bad); err == nil {
+			t.Errorf("parseGvdb(%d 字节) 未返回错误", len(bad))
+		}
+	}
+}
+
+func TestEncodeChangeset(t *testing.T) {
+	hosts := make([]string, 16)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("host%02d.example.com", i)
+	}
+
+	for _, tt := range []struct {
+		fixture string
+		changes map[string]any
+	}{
+		{"changeset-small", map[string]any{"/system/proxy/mode": "none"}},
+		{"changeset", map[string]any{
+			"/system/proxy/mode":           "manual",
+			"/system/proxy/http/host":      "127.0.0.1",
+			"/system/proxy/http/port":      int32(7890),
+			"/system/proxy/ignore-hosts":   hosts,
+			"/system/proxy/use-same-proxy": true,
+		}},
+	} {
+		want, err := os.ReadFile("testdata/dconf/" + tt.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := encodeChangeset(tt.changes)
+		if err != nil {
+			t.Fatalf("encodeChangeset(%s) error = %v", tt.fixture, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("encodeChangeset(%s) = %x, want %x", tt.fixture, got, want)
+		}
+	}
+}
+
+// 写入变更集的值与读取数据库的值使用同一种序列化格式
+func TestVariantRoundTrip(t *testing.T) {
+	long := make([]string, 40)
+	for i := range long {
+		long[i] = fmt.Sprintf("10.0.%d.0/24", i)
+	}
+	for _, value := range []any{"", "manual", true, false, int32(-1), int32(7890), []string{}, []string{"localhost", ""}, long} {
+		body, kind, err := encodeValue(value)
+		if err != nil {
+			t.Fatalf("encodeValue(%v) error = %v", value, err)
+		}
+		got, ok := decodeVariant(append(append(body, 0), kind...))
+		if !ok || !reflect.DeepEqual(got, value) {
+			t.Errorf("decodeVariant(encodeValue(%v)) = %v, %v", value, got, ok)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+//go:build linux
+
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// 桌面会话的主进程，优先从这些进程读取环境变量
+var sessionProcesses = []string{
+	"plasmashell",
+	"kwin_wayland",
+	"kwin_x11",
+	"ksmserver",
+	"gnome-shell",
+	"gnome-session-b",
+	"gnome-session",
+	"cinnamon-session",
+	"cinnamon",
+	"mate-session",
+	"budgie-wm",
+	"budgie-panel",
+	"xfce4-session",
+	"lxqt-session",
+	"startdde",
+	"dde-session",
+}
+
+// 检测时关注的配置工具
+var desktopTools = []string{
+	"kreadconfig6",
+	"kwriteconfig6",
+	"kreadconfig5",
+	"kwriteconfig5",
+	"gsettings",
+}
+
+// resolveDesktop 在 desktop 为空或 auto 时检测用户的桌面环境
+func resolveDesktop(desktop string, uid uint32) (string, error) {
+	if desktop != "" && desktop != "auto" {
+		return desktop, nil
+	}
+	info, err := DetectDesktop(uid)
+	if err != nil {
+		return "", err
+	}
+	if info.Desktop == "" {
+		return "", fmt.Errorf("无法检测桌面环境")
+	}
+	return info.Desktop, nil
+}
+
+// DetectDesktop 根据用户会话进程的环境变量与已安装的工具检测桌面环境
+func DetectDesktop(uid uint32) (*DesktopInfo, error) {
+	info := &DesktopInfo{Tools: []string{}}
+	for _, tool := range desktopTools {
+		if _, err := exec.LookPath(tool); err == nil {
+			info.Tools = append(info.Tools, tool)
+		}
+	}
+
+	if pid, env := findSessionEnv(uid); pid != 0 {
+		info.PID = pid
+		info.CurrentDesktop = env["XDG_CURRENT_DESKTOP"]
+		info.SessionVersion = env["KDE_SESSION_VERSION"]
+		info.Session = env["DESKTOP_SESSION"]
+		if desktop := desktopFromEnv(info); desktop != "" {
+			info.Desktop = desktop
+			info.Source = "environ"
+			return info, nil
+		}
+	}
+
+	if desktop := desktopFromTools(info.Tools); desktop != "" {
+		info.Desktop = desktop
+		info.Source = "tools"
+	}
+	return info, nil
+}
+
+// findSessionEnv 查找属于 uid 且带有桌面环境变量的进程
+func findSessionEnv(uid uint32) (int, map[string]string) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, nil
+	}
+
+	var (
+		fallbackPID int
+		fallbackEnv map[string]string
+	)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join("/proc", entry.Name())
+		info, err := os.Stat(dir)
+		if err != nil {
+			continue
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); !ok || stat.Uid != uid {
+			continue
+		}
+
+		env := readProcEnv(pid)
+		if env["XDG_CURRENT_DESKTOP"] == "" && env["DESKTOP_SESSION"] == "" {
+			continue
+		}
+
+		comm, _ := os.ReadFile(filepath.Join(dir, "comm"))
+		if slices.Contains(sessionProcesses, strings.TrimSpace(string(comm))) {
+			return pid, env
+		}
+		if fallbackPID == 0 {
+			fallbackPID, fallbackEnv = pid, env
+		}
+	}
+	return fallbackPID, fallbackEnv
+}
+
+func readProcEnv(pid int) map[string]string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return nil
+	}
+	env := map[string]string{}
+	for _, item := range bytes.Split(data, []byte{0}) {
+		if key, value, ok := strings.Cut(string(item), "="); ok {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// desktopFromEnv 将会话环境变量映射为支持的桌面类型
+func desktopFromEnv(info *DesktopInfo) string {
+	names := strings.Split(strings.ToLower(info.CurrentDesktop), ":")
+	session := strings.ToLower(info.Session)
+
+	if slices.Contains(names, "kde") || strings.HasPrefix(session, "plasma") {
+		switch info.SessionVersion {
+		case "6":
+			return "kde6"
+		case "5":
+			return "kde5"
+		}
+		if slices.Contains(info.Tools, "kwriteconfig6") {
+			return "kde6"
+		}
+		return "kde5"
+	}
+
+	for _, name := range append(names, session) {
+		switch name {
+		case "x-cinnamon", "cinnamon":
+			return "cinnamon"
+		case "mate":
+			return "mate"
+		case "budgie", "budgie-desktop":
+			return "budgie"
+		case "xfce", "xubuntu", "xfce4":
+			return "xfce"
+		case "lxqt", "lubuntu":
+			return "lxqt"
+		case "deepin", "dde":
+			return "deepin"
+		}
+	}
+	for _, name := range append(names, session) {
+		switch name {
+		case "gnome", "gnome-xorg", "gnome-classic", "ubuntu", "unity", "pantheon":
+			return "gnome"
+		}
+	}
+	return ""
+}
+
+// desktopFromTools 无法从环境变量判断时根据已安装的工具推断
+func desktopFromTools(tools []string) string {
+	switch {
+	case slices.Contains(tools, "kwriteconfig6"):
+		return "kde6"
+	case slices.Contains(tools, "kwriteconfig5"):
+		return "kde5"
+	case slices.Contains(tools, "gsettings"):
+		return "gnome"
+	}
+	return ""
+}
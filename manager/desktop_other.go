@@ -0,0 +1,10 @@
+//go:build !linux
+
+package manager
+
+import "runtime"
+
+// DetectDesktop 非 Linux 平台使用系统级代理设置，无需区分桌面环境
+func DetectDesktop(_ uint32) (*DesktopInfo, error) {
+	return &DesktopInfo{Desktop: runtime.GOOS, Source: "platform", Tools: []string{}}, nil
+}
@@ -0,0 +1,194 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLatencyURL         = "https://www.gstatic.com/generate_204"
+	defaultLatencyTimeout     = 5000
+	defaultLatencyConcurrency = 8
+	maxLatencyConcurrency     = 64
+)
+
+// 代理组及内置出站不参与延迟测试
+var latencySkipTypes = map[string]bool{
+	"Direct":      true,
+	"Reject":      true,
+	"RejectDrop":  true,
+	"Pass":        true,
+	"Compatible":  true,
+	"Selector":    true,
+	"URLTest":     true,
+	"Fallback":    true,
+	"LoadBalance": true,
+	"Relay":       true,
+}
+
+type LatencyOptions struct {
+	Config      string `json:"config"`
+	Path        string `json:"path"`
+	URL         string `json:"url"`
+	Timeout     int    `json:"timeout"`
+	Concurrency int    `json:"concurrency"`
+}
+
+type LatencyResult struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Delay int    `json:"delay"`
+	Error string `json:"error,omitempty"`
+}
+
+// LatencyTest 在沙盒中启动配置并测试其中每个代理的延迟
+func LatencyTest(opts LatencyOptions) ([]LatencyResult, error) {
+	data, err := readConfigSource(opts.Config, opts.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.URL == "" {
+		opts.URL = defaultLatencyURL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultLatencyTimeout
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultLatencyConcurrency
+	}
+	opts.Concurrency = min(opts.Concurrency, maxLatencyConcurrency)
+
+	s, p, g := randThreeStrings(10)
+	_, port, testConfig, err := parseConfig(data, s, p, g)
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+
+	proc, err := startProcess(testConfig, "latency-test", false)
+	if err != nil {
+		return nil, fmt.Errorf("进程启动失败: %s", err)
+	}
+	defer proc.Stop()
+
+	if err := waitForReady(proc.StdoutBuffer()); err != nil {
+		return nil, err
+	}
+
+	proxies, err := listProxies(port, s)
+	if err != nil {
+		return nil, err
+	}
+	delete(proxies, p)
+	delete(proxies, g)
+
+	return measureLatencies(port, s, proxies, opts), nil
+}
+
+// listProxies 返回控制器中除代理组与内置出站之外的代理及其类型
+func listProxies(port int, secret string) (map[string]string, error) {
+	resp, err := makeRequest(port, secret, http.MethodGet, "/proxies", nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取代理失败: %v", err)
+	}
+
+	var body struct {
+		Proxies map[string]struct {
+			Type string `json:"type"`
+		} `json:"proxies"`
+	}
+	if err := json.Unmarshal([]byte(resp), &body); err != nil {
+		return nil, fmt.Errorf("解析代理列表失败: %v", err)
+	}
+
+	proxies := make(map[string]string, len(body.Proxies))
+	for name, proxy := range body.Proxies {
+		if !latencySkipTypes[proxy.Type] {
+			proxies[name] = proxy.Type
+		}
+	}
+	return proxies, nil
+}
+
+func measureLatencies(port int, secret string, proxies map[string]string, opts LatencyOptions) []LatencyResult {
+	client := &http.Client{
+		Timeout: time.Duration(opts.Timeout)*time.Millisecond + 2*time.Second,
+	}
+
+	results := make([]LatencyResult, 0, len(proxies))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.Concurrency)
+
+	for name, proxyType := range proxies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result := LatencyResult{Name: name, Type: proxyType}
+			delay, err := proxyDelay(client, port, secret, name, opts.URL, opts.Timeout)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Delay = delay
+			}
+
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+func proxyDelay(client *http.Client, port int, secret, name, testURL string, timeout int) (int, error) {
+	query := url.Values{}
+	query.Set("url", testURL)
+	query.Set("timeout", fmt.Sprint(timeout))
+	reqURL := fmt.Sprintf("http://127.0.0.1:%d/proxies/%s/delay?%s", port, url.PathEscape(name), query.Encode())
+
+	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", secret))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	var body struct {
+		Delay   int    `json:"delay"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return 0, fmt.Errorf("解析响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if body.Message == "" {
+			body.Message = resp.Status
+		}
+		return 0, fmt.Errorf("%s", body.Message)
+	}
+	return body.Delay, nil
+}
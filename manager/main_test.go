@@ -0,0 +1,51 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sparkle-service/config"
+	"testing"
+)
+
+// TestMain 初始化临时的服务配置，并构建模拟核心 testdata/fakecore 供配置测试使用
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "sparkle-manager-test-*")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := 1
+	if err := setupTestConfig(dir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else {
+		code = m.Run()
+	}
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func setupTestConfig(dir string) error {
+	if err := config.Initialize(filepath.Join(dir, "config.yaml"), ""); err != nil {
+		return err
+	}
+
+	binName := "core"
+	if runtime.GOOS == "windows" {
+		binName += ".exe"
+	}
+	// 沙盒根目录中没有动态库，模拟核心需要静态链接
+	build := exec.Command("go", "build", "-o", filepath.Join(dir, binName), "./testdata/fakecore")
+	build.Env = append(os.Environ(), "CGO_ENABLED=0")
+	if out, err := build.CombinedOutput(); err != nil {
+		return fmt.Errorf("构建模拟核心失败: %v\n%s", err, out)
+	}
+
+	workDir := filepath.Join(dir, "work")
+	if err := os.Mkdir(workDir, 0755); err != nil {
+		return err
+	}
+	return config.UpdateConfig("core", dir, "", workDir, "", "", "", "", "")
+}
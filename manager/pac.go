@@ -0,0 +1,225 @@
+package manager
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/metacubex/bbolt"
+)
+
+// 生成的 PAC 脚本由服务在 /pac/{name}.pac 提供，只支持 PAC 的后端也通过生成的脚本实现手动代理。
+// 脚本只使用固定的语句格式，以便读取时还原设置，并可以在不执行 JavaScript 的情况下计算结果
+const (
+	pacHeader = "// 由 Sparkle 生成，请勿手动修改"
+	pacBucket = "pac-scripts"
+)
+
+var (
+	pacDirectRule = regexp.MustCompile(`^\s*if \((.+)\) return "DIRECT";$`)
+	pacSchemeRule = regexp.MustCompile(`^\s*if \(url\.substring\(0, \d+\) == "(\w+):"\) return "PROXY ([^;"]+); DIRECT";$`)
+	pacDefault    = regexp.MustCompile(`^\s*return "(.+)";$`)
+	pacCondition  = regexp.MustCompile(`isPlainHostName\(host\)|shExpMatch\(host, "([^"]*)"\)|isInNet\(host, "([^"]*)", "([^"]*)"\)`)
+	pacName       = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// PacSpec 为生成 PAC 脚本的参数，Direct 与 Proxy 为始终直连或始终使用代理的域名，
+// 域名同时匹配其子域名
+type PacSpec struct {
+	Name   string   `json:"name"`
+	Server string   `json:"server"`
+	Socks  string   `json:"socks"`
+	Bypass string   `json:"bypass"`
+	Direct []string `json:"direct"`
+	Proxy  []string `json:"proxy"`
+	// Default 为其他地址的处理方式，direct 或 proxy，默认使用代理
+	Default string `json:"default"`
+}
+
+// SavePac 生成 PAC 脚本并保存，返回脚本名称
+func SavePac(spec PacSpec) (string, error) {
+	if spec.Name == "" {
+		spec.Name = "sparkle"
+	}
+	script, err := GeneratePac(spec)
+	if err != nil {
+		return "", err
+	}
+	db, err := openCacheDB()
+	if err != nil {
+		return "", err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(pacBucket)).Put([]byte(spec.Name), []byte(script))
+	})
+	if err != nil {
+		return "", fmt.Errorf("保存 PAC 脚本失败：%w", err)
+	}
+	return spec.Name, nil
+}
+
+// LoadPac 读取保存的 PAC 脚本，不存在时返回空字符串
+func LoadPac(name string) (string, error) {
+	db, err := openCacheDB()
+	if err != nil {
+		return "", err
+	}
+	var script string
+	err = db.View(func(tx *bbolt.Tx) error {
+		script = string(tx.Bucket([]byte(pacBucket)).Get([]byte(name)))
+		return nil
+	})
+	return script, err
+}
+
+// GeneratePac 校验参数并生成 PAC 脚本
+func GeneratePac(spec PacSpec) (string, error) {
+	if !pacName.MatchString(spec.Name) {
+		return "", fmt.Errorf("无效的 PAC 名称：%s", spec.Name)
+	}
+	if spec.Default != "" && spec.Default != "direct" && spec.Default != "proxy" {
+		return "", fmt.Errorf("无效的默认规则：%s", spec.Default)
+	}
+	if spec.Server == "" && spec.Socks == "" {
+		return "", fmt.Errorf("未指定代理服务器")
+	}
+	bypass, err := ParseBypass(spec.Bypass)
+	if err != nil {
+		return "", err
+	}
+	config := &ProxyConfig{}
+	config.Proxy.Enable = true
+	config.Proxy.SameForAll = true
+	config.Proxy.Bypass = bypass.String()
+	config.Proxy.Servers = map[string]string{}
+	for _, key := range []string{"http_server", "https_server", "ftp_server"} {
+		config.Proxy.Servers[key] = spec.Server
+	}
+	config.Proxy.Servers["socks_server"] = spec.Socks
+	for _, server := range config.Proxy.Servers {
+		if server == "" {
+			continue
+		}
+		if err := validateServer(server); err != nil {
+			return "", err
+		}
+	}
+	for _, domain := range append(append([]string{}, spec.Direct...), spec.Proxy...) {
+		if domain == "" || strings.ContainsAny(domain, "\"\\ ,;") {
+			return "", fmt.Errorf("无效的域名：%s", domain)
+		}
+	}
+	return renderPac(config, spec.Direct, spec.Proxy, spec.Default == "direct")
+}
+
+// generatePac 根据手动代理设置生成 PAC 脚本
+func generatePac(config *ProxyConfig) (string, error) {
+	return renderPac(config, nil, nil, false)
+}
+
+// renderPac 依次输出例外列表、直连域名、代理域名、按协议的代理与默认规则
+func renderPac(config *ProxyConfig, direct, proxy []string, defaultDirect bool) (string, error) {
+	conditions, err := splitBypass(config.Proxy.Bypass).Pac()
+	if err != nil {
+		return "", err
+	}
+	servers := config.Proxy.Servers
+	var b strings.Builder
+	b.WriteString(pacHeader + "\n")
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+
+	if len(conditions) > 0 {
+		fmt.Fprintf(&b, "\tif (%s) return \"DIRECT\";\n", strings.Join(conditions, " || "))
+	}
+
+	var fallback []string
+	if server := servers["http_server"]; server != "" {
+		fallback = append(fallback, "PROXY "+server)
+	}
+	if server := servers["socks_server"]; server != "" {
+		fallback = append(fallback, "SOCKS5 "+server)
+	}
+	fallback = append(fallback, "DIRECT")
+	proxyResult := strings.Join(fallback, "; ")
+
+	if len(direct) > 0 {
+		fmt.Fprintf(&b, "\tif (%s) return \"DIRECT\";\n", pacDomainConditions(direct))
+	}
+	if len(proxy) > 0 {
+		fmt.Fprintf(&b, "\tif (%s) return \"%s\";\n", pacDomainConditions(proxy), proxyResult)
+	}
+
+	for _, scheme := range []string{"https", "ftp"} {
+		if server := servers[scheme+"_server"]; server != "" && server != servers["http_server"] {
+			fmt.Fprintf(&b, "\tif (url.substring(0, %d) == \"%s:\") return \"PROXY %s; DIRECT\";\n", len(scheme)+1, scheme, server)
+		}
+	}
+
+	if defaultDirect {
+		proxyResult = "DIRECT"
+	}
+	fmt.Fprintf(&b, "\treturn \"%s\";\n", proxyResult)
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+// pacDomainConditions 生成匹配域名及其子域名的条件
+func pacDomainConditions(domains []string) string {
+	var conditions []string
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.TrimPrefix(domain, "*"), ".")
+		if strings.ContainsAny(domain, "*?") {
+			conditions = append(conditions, fmt.Sprintf("shExpMatch(host, %q)", domain))
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("shExpMatch(host, %q) || shExpMatch(host, %q)", domain, "*."+domain))
+	}
+	return strings.Join(conditions, " || ")
+}
+
+// parsePac 还原 generatePac 生成的脚本，不是由本服务生成的脚本返回 false
+func parsePac(script string) (*ProxyConfig, bool) {
+	if !strings.HasPrefix(script, pacHeader) {
+		return nil, false
+	}
+
+	config := &ProxyConfig{}
+	config.Proxy.Enable = true
+	config.Proxy.Servers = map[string]string{}
+	var bypass []string
+	for _, line := range strings.Split(script, "\n") {
+		if match := pacDirectRule.FindStringSubmatch(line); match != nil {
+			for _, condition := range pacCondition.FindAllStringSubmatch(match[1], -1) {
+				switch {
+				case condition[0] == "isPlainHostName(host)":
+					bypass = append(bypass, "<local>")
+				case condition[2] != "":
+					ones, _ := net.IPMask(net.ParseIP(condition[3]).To4()).Size()
+					bypass = append(bypass, fmt.Sprintf("%s/%d", condition[2], ones))
+				default:
+					bypass = append(bypass, condition[1])
+				}
+			}
+		} else if match := pacSchemeRule.FindStringSubmatch(line); match != nil {
+			config.Proxy.Servers[match[1]+"_server"] = match[2]
+		} else if match := pacDefault.FindStringSubmatch(line); match != nil {
+			for _, item := range strings.Split(match[1], "; ") {
+				if server, ok := strings.CutPrefix(item, "PROXY "); ok {
+					config.Proxy.Servers["http_server"] = server
+				} else if server, ok := strings.CutPrefix(item, "SOCKS5 "); ok {
+					config.Proxy.Servers["socks_server"] = server
+				}
+			}
+		}
+	}
+	for _, scheme := range []string{"https", "ftp"} {
+		if config.Proxy.Servers[scheme+"_server"] == "" {
+			config.Proxy.Servers[scheme+"_server"] = config.Proxy.Servers["http_server"]
+		}
+	}
+	config.Proxy.SameForAll = config.Proxy.Servers["https_server"] == config.Proxy.Servers["http_server"] &&
+		config.Proxy.Servers["ftp_server"] == config.Proxy.Servers["http_server"]
+	config.Proxy.Bypass = parseNativeBypass(bypass).String()
+	return config, true
+}
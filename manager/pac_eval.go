@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	pacIfRule     = regexp.MustCompile(`^if \((.+)\) return "([^"]*)";$`)
+	pacReturnRule = regexp.MustCompile(`^return "([^"]*)";$`)
+	pacAtom       = regexp.MustCompile(`^(?:isPlainHostName\(host\)|shExpMatch\(host, "([^"]*)"\)|isInNet\(host, "([^"]*)", "([^"]*)"\)|url\.substring\(0, (\d+)\) == "([^"]*)")$`)
+)
+
+// EvaluatePac 计算 renderPac 生成的脚本对 rawURL 返回的结果。
+// 只支持生成脚本使用的语句，isInNet 不解析域名，只匹配 IPv4 地址
+func EvaluatePac(script, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("无效的地址：%s", rawURL)
+	}
+	host := strings.ToLower(u.Hostname())
+
+	inBody := false
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "//"):
+		case line == "function FindProxyForURL(url, host) {":
+			inBody = true
+		case !inBody || line == "}":
+			return "", fmt.Errorf("不支持的语句：%s", line)
+		default:
+			if match := pacReturnRule.FindStringSubmatch(line); match != nil {
+				return match[1], nil
+			}
+			match := pacIfRule.FindStringSubmatch(line)
+			if match == nil {
+				return "", fmt.Errorf("不支持的语句：%s", line)
+			}
+			matched, err := evaluatePacCondition(match[1], rawURL, host)
+			if err != nil {
+				return "", err
+			}
+			if matched {
+				return match[2], nil
+			}
+		}
+	}
+	return "", errors.New("PAC 脚本没有返回结果")
+}
+
+func evaluatePacCondition(condition, rawURL, host string) (bool, error) {
+	for _, atom := range strings.Split(condition, " || ") {
+		match := pacAtom.FindStringSubmatch(atom)
+		var matched bool
+		switch {
+		case match == nil:
+			return false, fmt.Errorf("不支持的条件：%s", atom)
+		case match[0] == "isPlainHostName(host)":
+			matched = !strings.Contains(host, ".")
+		case strings.HasPrefix(match[0], "shExpMatch"):
+			matched = shExpMatch(host, match[1])
+		case strings.HasPrefix(match[0], "isInNet"):
+			matched = isInNet(host, match[2], match[3])
+		default:
+			n, _ := strconv.Atoi(match[4])
+			matched = rawURL[:min(n, len(rawURL))] == match[5]
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// shExpMatch 按 shell 通配符匹配，* 匹配任意字符，? 匹配单个字符
+func shExpMatch(s, pattern string) bool {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.NewReplacer(`\*`, `.*`, `\?`, `.`).Replace(expr)
+	matched, _ := regexp.MatchString("^"+expr+"$", s)
+	return matched
+}
+
+func isInNet(host, pattern, mask string) bool {
+	ip, network, m := net.ParseIP(host).To4(), net.ParseIP(pattern).To4(), net.ParseIP(mask).To4()
+	if ip == nil || network == nil || m == nil {
+		return false
+	}
+	return ip.Mask(net.IPMask(m)).Equal(network.Mask(net.IPMask(m)))
+}
@@ -0,0 +1,136 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeneratePacEvaluate(t *testing.T) {
+	script, err := GeneratePac(PacSpec{
+		Name:   "test",
+		Server: "127.0.0.1:7890",
+		Socks:  "127.0.0.1:7891",
+		Bypass: "<local>,10.0.0.0/8,*.lan,example.org",
+		Direct: []string{"direct.com"},
+		Proxy:  []string{"*.proxy.com", "cdn?.example.net"},
+	})
+	if err != nil {
+		t.Fatalf("GeneratePac() error = %v", err)
+	}
+
+	const proxy = "PROXY 127.0.0.1:7890; SOCKS5 127.0.0.1:7891; DIRECT"
+	for _, tt := range []struct {
+		url  string
+		want string
+	}{
+		{"http://intranet/", "DIRECT"},
+		{"http://10.1.2.3/", "DIRECT"},
+		{"http://11.1.2.3/", proxy},
+		{"https://nas.lan/", "DIRECT"},
+		{"https://example.org/", "DIRECT"},
+		{"https://www.example.org/", proxy},
+		{"https://direct.com/", "DIRECT"},
+		{"https://a.direct.com/", "DIRECT"},
+		{"https://notdirect.com/", proxy},
+		{"https://proxy.com/", proxy},
+		{"https://cdn1.example.net/", proxy},
+		{"https://www.google.com/", proxy},
+	} {
+		got, err := EvaluatePac(script, tt.url)
+		if err != nil {
+			t.Fatalf("EvaluatePac(%q) error = %v", tt.url, err)
+		}
+		if got != tt.want {
+			t.Errorf("EvaluatePac(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestGeneratePacDefaultDirect(t *testing.T) {
+	script, err := GeneratePac(PacSpec{
+		Name:    "test",
+		Server:  "127.0.0.1:7890",
+		Proxy:   []string{"google.com"},
+		Default: "direct",
+	})
+	if err != nil {
+		t.Fatalf("GeneratePac() error = %v", err)
+	}
+	for url, want := range map[string]string{
+		"https://www.google.com/": "PROXY 127.0.0.1:7890; DIRECT",
+		"https://example.com/":    "DIRECT",
+	} {
+		if got, err := EvaluatePac(script, url); err != nil || got != want {
+			t.Errorf("EvaluatePac(%q) = %q, %v, want %q", url, got, err, want)
+		}
+	}
+}
+
+func TestRenderPacSchemes(t *testing.T) {
+	config := &ProxyConfig{}
+	config.Proxy.Enable = true
+	config.Proxy.Servers = map[string]string{
+		"http_server":  "127.0.0.1:7890",
+		"https_server": "127.0.0.1:7892",
+		"ftp_server":   "127.0.0.1:7893",
+	}
+	config.Proxy.Bypass = "localhost,192.168.0.0/16"
+	script, err := generatePac(config)
+	if err != nil {
+		t.Fatalf("generatePac() error = %v", err)
+	}
+
+	for url, want := range map[string]string{
+		"http://example.com/":    "PROXY 127.0.0.1:7890; DIRECT",
+		"https://example.com/":   "PROXY 127.0.0.1:7892; DIRECT",
+		"ftp://example.com/":     "PROXY 127.0.0.1:7893; DIRECT",
+		"https://localhost/":     "DIRECT",
+		"https://192.168.1.1/":   "DIRECT",
+		"https://192.169.1.1/":   "PROXY 127.0.0.1:7892; DIRECT",
+		"http://[2001:db8::1]/":  "PROXY 127.0.0.1:7890; DIRECT",
+		"https://localhost:443/": "DIRECT",
+	} {
+		if got, err := EvaluatePac(script, url); err != nil || got != want {
+			t.Errorf("EvaluatePac(%q) = %q, %v, want %q", url, got, err, want)
+		}
+	}
+
+	parsed, ok := parsePac(script)
+	if !ok {
+		t.Fatal("parsePac() 无法还原生成的脚本")
+	}
+	if parsed.Proxy.Bypass != config.Proxy.Bypass || parsed.Proxy.SameForAll {
+		t.Errorf("parsePac() bypass = %q, same_for_all = %v", parsed.Proxy.Bypass, parsed.Proxy.SameForAll)
+	}
+	for key, want := range config.Proxy.Servers {
+		if got := parsed.Proxy.Servers[key]; got != want {
+			t.Errorf("parsePac() %s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestGeneratePacErrors(t *testing.T) {
+	for _, spec := range []PacSpec{
+		{Name: "bad name", Server: "127.0.0.1:7890"},
+		{Name: "test"},
+		{Name: "test", Server: "127.0.0.1:7890", Default: "reject"},
+		{Name: "test", Server: "127.0.0.1:7890", Bypass: "fd00::/8"},
+		{Name: "test", Server: "127.0.0.1:7890", Bypass: "exa$mple.com"},
+		{Name: "test", Server: "127.0.0.1:7890", Direct: []string{`a"b`}},
+	} {
+		if _, err := GeneratePac(spec); err == nil {
+			t.Errorf("GeneratePac(%+v) 未返回错误", spec)
+		}
+	}
+}
+
+func TestEvaluatePacUnsupported(t *testing.T) {
+	for _, script := range []string{
+		"function FindProxyForURL(url, host) {\n\tif (dnsResolve(host)) return \"DIRECT\";\n}\n",
+		"function FindProxyForURL(url, host) {\n}\n",
+	} {
+		if _, err := EvaluatePac(script, "https://example.com/"); err == nil || !strings.Contains(err.Error(), "不支持") {
+			t.Errorf("EvaluatePac() error = %v, want 不支持的语句或条件", err)
+		}
+	}
+}
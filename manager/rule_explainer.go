@@ -0,0 +1,512 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sparkle-service/config"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+type ExplainRequest struct {
+	Config  string `json:"config"`
+	Path    string `json:"path"`
+	Host    string `json:"host"`
+	IP      string `json:"ip"`
+	SrcIP   string `json:"src_ip"`
+	Port    int    `json:"port"`
+	Process string `json:"process"`
+}
+
+type ExplainRule struct {
+	Index  int    `json:"index"`
+	Rule   string `json:"rule"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type ChainNode struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ExplainResult 中 Undetermined 为第一条无法在本地判定的规则，
+// 此时无法得知该规则及之后的规则是否匹配，Matched 为空
+type ExplainResult struct {
+	Matched      *ExplainRule `json:"matched"`
+	Undetermined *ExplainRule `json:"undetermined"`
+	Chain        []ChainNode  `json:"chain"`
+}
+
+type explainTarget struct {
+	host    string
+	ip      netip.Addr
+	srcIP   netip.Addr
+	port    int
+	process string
+}
+
+// errUnsupported 表示规则无法在本地判定，需如实上报而非猜测
+type errUnsupported struct {
+	reason string
+}
+
+func (e *errUnsupported) Error() string {
+	return e.reason
+}
+
+// ExplainRuleMatch 找出配置中第一条匹配目标的规则并解析其代理链
+func ExplainRuleMatch(req ExplainRequest) (*ExplainResult, error) {
+	data, err := readConfigSource(req.Config, req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := newExplainTarget(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var conf map[string]any
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+
+	providers, _ := conf["rule-providers"].(map[string]any)
+	result := &ExplainResult{Chain: []ChainNode{}}
+
+	for i, item := range get(conf, "rules") {
+		line, ok := item.(string)
+		if !ok {
+			continue
+		}
+		ruleType, payload, proxy, params := splitRule(line)
+
+		matched, err := matchRule(ruleType, payload, params, target, providers)
+		if err != nil {
+			result.Undetermined = &ExplainRule{Index: i, Rule: line, Reason: err.Error()}
+			break
+		}
+		if matched {
+			result.Matched = &ExplainRule{Index: i, Rule: line}
+			result.Chain = resolveChain(conf, proxy)
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func newExplainTarget(req ExplainRequest) (explainTarget, error) {
+	target := explainTarget{
+		host:    strings.ToLower(strings.TrimSuffix(req.Host, ".")),
+		port:    req.Port,
+		process: req.Process,
+	}
+
+	if addr, err := netip.ParseAddr(strings.Trim(target.host, "[]")); err == nil {
+		target.ip = addr.Unmap()
+		target.host = ""
+	}
+	if req.IP != "" {
+		addr, err := netip.ParseAddr(req.IP)
+		if err != nil {
+			return target, fmt.Errorf("无效的 IP: %s", req.IP)
+		}
+		target.ip = addr.Unmap()
+	}
+	if req.SrcIP != "" {
+		addr, err := netip.ParseAddr(req.SrcIP)
+		if err != nil {
+			return target, fmt.Errorf("无效的源 IP: %s", req.SrcIP)
+		}
+		target.srcIP = addr.Unmap()
+	}
+
+	if target.host == "" && !target.ip.IsValid() {
+		return target, fmt.Errorf("host 与 ip 不能同时为空")
+	}
+	return target, nil
+}
+
+// ruleParams 为规则末尾可出现的附加参数
+var ruleParams = map[string]bool{"no-resolve": true, "src": true}
+
+// splitRule 拆分规则为类型、载荷、目标与附加参数。
+// 正则表达式与逻辑规则的载荷可能包含逗号，因此先从末尾取出附加参数与目标
+func splitRule(line string) (string, string, string, []string) {
+	ruleType, fields := splitFields(line)
+	if ruleType == "MATCH" {
+		if len(fields) == 0 {
+			return ruleType, "", "", nil
+		}
+		return ruleType, "", strings.TrimSpace(fields[0]), nil
+	}
+
+	fields, params := cutParams(fields)
+	switch len(fields) {
+	case 0:
+		return ruleType, "", "", params
+	case 1:
+		return ruleType, strings.TrimSpace(fields[0]), "", params
+	}
+	last := len(fields) - 1
+	return ruleType, joinPayload(fields[:last]), strings.TrimSpace(fields[last]), params
+}
+
+// splitClassical 拆分 classical 规则集条目与逻辑规则的子规则，条目不包含目标
+func splitClassical(entry string) (string, string, []string) {
+	ruleType, fields := splitFields(entry)
+	fields, params := cutParams(fields)
+	return ruleType, joinPayload(fields), params
+}
+
+func splitFields(line string) (string, []string) {
+	parts := strings.Split(line, ",")
+	return strings.ToUpper(strings.TrimSpace(parts[0])), parts[1:]
+}
+
+// cutParams 取出末尾的附加参数
+func cutParams(fields []string) ([]string, []string) {
+	var params []string
+	for len(fields) > 0 {
+		param := strings.TrimSpace(fields[len(fields)-1])
+		if !ruleParams[strings.ToLower(param)] {
+			break
+		}
+		params = append([]string{param}, params...)
+		fields = fields[:len(fields)-1]
+	}
+	return fields, params
+}
+
+// joinPayload 还原被逗号拆开的载荷，载荷内部的空白原样保留
+func joinPayload(fields []string) string {
+	return strings.TrimSpace(strings.Join(fields, ","))
+}
+
+// splitLogical 拆分逻辑规则的载荷，如 "((DOMAIN,a.com),(DST-PORT,443))"
+func splitLogical(payload string) ([]string, error) {
+	inner, ok := strings.CutPrefix(payload, "(")
+	if ok {
+		inner, ok = strings.CutSuffix(inner, ")")
+	}
+	if !ok {
+		return nil, &errUnsupported{fmt.Sprintf("无效的逻辑规则: %s", payload)}
+	}
+
+	var rules []string
+	depth, start := 0, -1
+	for i, c := range inner {
+		switch c {
+		case '(':
+			if depth == 0 {
+				start = i + 1
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				rules = append(rules, inner[start:i])
+			}
+		case ',':
+			if depth == 0 {
+				continue
+			}
+		default:
+			if depth == 0 && !unicode.IsSpace(c) {
+				return nil, &errUnsupported{fmt.Sprintf("无效的逻辑规则: %s", payload)}
+			}
+		}
+		if depth < 0 {
+			return nil, &errUnsupported{fmt.Sprintf("无效的逻辑规则: %s", payload)}
+		}
+	}
+	if depth != 0 || len(rules) == 0 {
+		return nil, &errUnsupported{fmt.Sprintf("无效的逻辑规则: %s", payload)}
+	}
+	return rules, nil
+}
+
+// matchLogical 判定 AND、OR、NOT 规则，任一子规则无法判定时整条规则无法判定
+func matchLogical(ruleType, payload string, target explainTarget, providers map[string]any) (bool, error) {
+	rules, err := splitLogical(payload)
+	if err != nil {
+		return false, err
+	}
+	if ruleType == "NOT" && len(rules) != 1 {
+		return false, &errUnsupported{fmt.Sprintf("NOT 规则只能包含一条子规则: %s", payload)}
+	}
+
+	results := make([]bool, len(rules))
+	for i, rule := range rules {
+		subType, subPayload, subParams := splitClassical(rule)
+		if results[i], err = matchRule(subType, subPayload, subParams, target, providers); err != nil {
+			return false, err
+		}
+	}
+
+	switch ruleType {
+	case "AND":
+		return !slices.Contains(results, false), nil
+	case "OR":
+		return slices.Contains(results, true), nil
+	default:
+		return !results[0], nil
+	}
+}
+
+func matchRule(ruleType, payload string, params []string, target explainTarget, providers map[string]any) (bool, error) {
+	switch ruleType {
+	case "MATCH":
+		return true, nil
+	case "DOMAIN":
+		return target.host != "" && target.host == strings.ToLower(payload), nil
+	case "DOMAIN-SUFFIX":
+		return matchDomainSuffix(target.host, strings.ToLower(payload)), nil
+	case "DOMAIN-KEYWORD":
+		return target.host != "" && strings.Contains(target.host, strings.ToLower(payload)), nil
+	case "DOMAIN-REGEX":
+		re, err := regexp.Compile(payload)
+		if err != nil {
+			return false, &errUnsupported{fmt.Sprintf("无效的正则表达式: %v", err)}
+		}
+		return target.host != "" && re.MatchString(target.host), nil
+	case "IP-CIDR", "IP-CIDR6":
+		if !target.ip.IsValid() {
+			if target.host != "" && !hasParam(params, "no-resolve") {
+				return false, &errUnsupported{"需要解析域名才能判定，请提供 ip"}
+			}
+			return false, nil
+		}
+		return matchCIDR(payload, target.ip)
+	case "SRC-IP-CIDR":
+		if !target.srcIP.IsValid() {
+			return false, nil
+		}
+		return matchCIDR(payload, target.srcIP)
+	case "DST-PORT":
+		if target.port == 0 {
+			return false, nil
+		}
+		return matchPort(payload, target.port)
+	case "PROCESS-NAME":
+		return target.process != "" && strings.EqualFold(filepath.Base(target.process), payload), nil
+	case "RULE-SET":
+		return matchRuleSet(payload, params, target, providers)
+	case "AND", "OR", "NOT":
+		return matchLogical(ruleType, payload, target, providers)
+	default:
+		return false, &errUnsupported{fmt.Sprintf("不支持的规则类型: %s", ruleType)}
+	}
+}
+
+func matchDomainSuffix(host, suffix string) bool {
+	if host == "" || suffix == "" {
+		return false
+	}
+	return host == suffix || strings.HasSuffix(host, "."+suffix)
+}
+
+func matchCIDR(payload string, addr netip.Addr) (bool, error) {
+	prefix, err := netip.ParsePrefix(payload)
+	if err != nil {
+		return false, &errUnsupported{fmt.Sprintf("无效的 CIDR: %s", payload)}
+	}
+	return prefix.Masked().Contains(addr), nil
+}
+
+// matchPort 支持 "80"、"80-90" 及以 "/" 分隔的组合
+func matchPort(payload string, port int) (bool, error) {
+	for _, part := range strings.Split(payload, "/") {
+		start, end, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(start)
+		if err != nil {
+			return false, &errUnsupported{fmt.Sprintf("无效的端口: %s", payload)}
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(end); err != nil {
+				return false, &errUnsupported{fmt.Sprintf("无效的端口: %s", payload)}
+			}
+		}
+		if port >= from && port <= to {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func hasParam(params []string, name string) bool {
+	for _, p := range params {
+		if strings.EqualFold(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRuleSet(name string, params []string, target explainTarget, providers map[string]any) (bool, error) {
+	provider, ok := providers[name].(map[string]any)
+	if !ok {
+		return false, &errUnsupported{fmt.Sprintf("未找到规则集: %s", name)}
+	}
+
+	providerType, _ := provider["type"].(string)
+	if providerType != "file" {
+		return false, &errUnsupported{fmt.Sprintf("不支持的规则集类型: %s", providerType)}
+	}
+	format, _ := provider["format"].(string)
+	if format == "mrs" {
+		return false, &errUnsupported{"不支持 mrs 格式的规则集"}
+	}
+
+	path, _ := provider["path"].(string)
+	if path == "" {
+		return false, &errUnsupported{fmt.Sprintf("规则集 %s 未设置路径", name)}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(config.GetWorkDir(), path)
+	}
+
+	payload, err := loadRuleSetPayload(path, format)
+	if err != nil {
+		return false, &errUnsupported{fmt.Sprintf("读取规则集 %s 失败: %v", name, err)}
+	}
+
+	behavior, _ := provider["behavior"].(string)
+	for _, entry := range payload {
+		var matched bool
+		switch behavior {
+		case "domain":
+			matched = matchDomainEntry(target.host, strings.ToLower(entry))
+		case "ipcidr":
+			if !target.ip.IsValid() {
+				if target.host != "" && !hasParam(params, "no-resolve") {
+					return false, &errUnsupported{"需要解析域名才能判定，请提供 ip"}
+				}
+				return false, nil
+			}
+			matched, err = matchCIDR(entry, target.ip)
+		case "classical":
+			ruleType, rulePayload, entryParams := splitClassical(entry)
+			if ruleType == "RULE-SET" {
+				return false, &errUnsupported{"不支持嵌套规则集"}
+			}
+			matched, err = matchRule(ruleType, rulePayload, entryParams, target, providers)
+		default:
+			return false, &errUnsupported{fmt.Sprintf("不支持的规则集行为: %s", behavior)}
+		}
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchDomainEntry 匹配 domain 行为规则集中的条目
+func matchDomainEntry(host, entry string) bool {
+	if host == "" || entry == "" {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(entry, "+."):
+		return matchDomainSuffix(host, entry[2:])
+	case strings.HasPrefix(entry, "."):
+		return strings.HasSuffix(host, entry)
+	case strings.HasPrefix(entry, "*."):
+		rest, ok := strings.CutSuffix(host, entry[1:])
+		return ok && rest != "" && !strings.Contains(rest, ".")
+	default:
+		return host == entry
+	}
+}
+
+func loadRuleSetPayload(path, format string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "text" {
+		var payload []string
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			payload = append(payload, line)
+		}
+		return payload, scanner.Err()
+	}
+
+	var content struct {
+		Payload []string `yaml:"payload"`
+	}
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		return nil, err
+	}
+	for i := range content.Payload {
+		content.Payload[i] = strings.Trim(strings.TrimSpace(content.Payload[i]), "'\"")
+	}
+	return content.Payload, nil
+}
+
+// resolveChain 沿代理组静态解析目标，选择类代理组取第一个成员
+func resolveChain(conf map[string]any, name string) []ChainNode {
+	groups := map[string]map[string]any{}
+	for _, item := range get(conf, "proxy-groups") {
+		if group, ok := item.(map[string]any); ok {
+			if groupName, ok := group["name"].(string); ok {
+				groups[groupName] = group
+			}
+		}
+	}
+	proxies := map[string]string{}
+	for _, item := range get(conf, "proxies") {
+		if proxy, ok := item.(map[string]any); ok {
+			if proxyName, ok := proxy["name"].(string); ok {
+				proxyType, _ := proxy["type"].(string)
+				proxies[proxyName] = proxyType
+			}
+		}
+	}
+
+	chain := []ChainNode{}
+	visited := map[string]bool{}
+	for name != "" && !visited[name] {
+		visited[name] = true
+
+		group, isGroup := groups[name]
+		if !isGroup {
+			nodeType, ok := proxies[name]
+			if !ok {
+				nodeType = strings.ToLower(name)
+			}
+			chain = append(chain, ChainNode{Name: name, Type: nodeType})
+			break
+		}
+
+		groupType, _ := group["type"].(string)
+		chain = append(chain, ChainNode{Name: name, Type: groupType})
+
+		members, _ := group["proxies"].([]any)
+		name = ""
+		if len(members) > 0 {
+			name, _ = members[0].(string)
+		}
+	}
+	return chain
+}
@@ -0,0 +1,120 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitRule(t *testing.T) {
+	for _, tt := range []struct {
+		line     string
+		ruleType string
+		payload  string
+		proxy    string
+		params   []string
+	}{
+		{"MATCH,Proxy", "MATCH", "", "Proxy", nil},
+		{"domain-suffix, example.com ,DIRECT", "DOMAIN-SUFFIX", "example.com", "DIRECT", nil},
+		{"IP-CIDR,10.0.0.0/8,DIRECT,no-resolve", "IP-CIDR", "10.0.0.0/8", "DIRECT", []string{"no-resolve"}},
+		{`DOMAIN-REGEX,^(a|b)\.c{1,3}\.com$,Proxy`, "DOMAIN-REGEX", `^(a|b)\.c{1,3}\.com$`, "Proxy", nil},
+		{"AND,((DOMAIN,a.com),(DST-PORT,443)),Proxy", "AND", "((DOMAIN,a.com),(DST-PORT,443))", "Proxy", nil},
+	} {
+		ruleType, payload, proxy, params := splitRule(tt.line)
+		if ruleType != tt.ruleType || payload != tt.payload || proxy != tt.proxy || !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("splitRule(%q) = %q, %q, %q, %q", tt.line, ruleType, payload, proxy, params)
+		}
+	}
+}
+
+func TestExplainRuleMatch(t *testing.T) {
+	ruleSet := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(ruleSet, []byte("payload:\n  - DOMAIN-SUFFIX,ruleset.com\n  - IP-CIDR,172.16.0.0/12,no-resolve\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := `
+proxies:
+  - {name: hk, type: ss}
+proxy-groups:
+  - {name: Proxy, type: select, proxies: [Auto, DIRECT]}
+  - {name: Auto, type: url-test, proxies: [hk]}
+rule-providers:
+  local: {type: file, behavior: classical, path: ` + ruleSet + `}
+rules:
+  - DOMAIN,exact.com,DIRECT
+  - DOMAIN-REGEX,^(www|api)\.re{1,2}g\.com$,Proxy
+  - AND,((DOMAIN-SUFFIX,and.com),(DST-PORT,443)),REJECT
+  - NOT,((DST-PORT,1-1024)),DIRECT
+  - RULE-SET,local,Auto
+  - IP-CIDR,10.0.0.0/8,DIRECT,no-resolve
+  - GEOIP,CN,DIRECT
+  - MATCH,Proxy
+`
+	for _, tt := range []struct {
+		req          ExplainRequest
+		matched      int
+		undetermined int
+		chain        []string
+	}{
+		{ExplainRequest{Host: "exact.com", Port: 443}, 0, -1, []string{"DIRECT"}},
+		{ExplainRequest{Host: "api.reeg.com", Port: 443}, 1, -1, []string{"Proxy", "Auto", "hk"}},
+		{ExplainRequest{Host: "www.and.com", Port: 443}, 2, -1, []string{"REJECT"}},
+		{ExplainRequest{Host: "www.and.com", Port: 8080}, 3, -1, []string{"DIRECT"}},
+		{ExplainRequest{Host: "a.ruleset.com", Port: 80}, 4, -1, []string{"Auto", "hk"}},
+		{ExplainRequest{Host: "172.16.1.1", Port: 80}, 4, -1, []string{"Auto", "hk"}},
+		{ExplainRequest{Host: "10.1.1.1", Port: 80}, 5, -1, []string{"DIRECT"}},
+		// GEOIP 无法在本地判定，之后的 MATCH 不能视为匹配
+		{ExplainRequest{Host: "example.com", Port: 80}, -1, 6, nil},
+	} {
+		tt.req.Config = conf
+		result, err := ExplainRuleMatch(tt.req)
+		if err != nil {
+			t.Fatalf("ExplainRuleMatch(%s) error = %v", tt.req.Host, err)
+		}
+		if got := ruleIndex(result.Matched); got != tt.matched {
+			t.Errorf("ExplainRuleMatch(%s:%d) matched = %d, want %d", tt.req.Host, tt.req.Port, got, tt.matched)
+		}
+		if got := ruleIndex(result.Undetermined); got != tt.undetermined {
+			t.Errorf("ExplainRuleMatch(%s:%d) undetermined = %d, want %d", tt.req.Host, tt.req.Port, got, tt.undetermined)
+		}
+		var chain []string
+		for _, node := range result.Chain {
+			chain = append(chain, node.Name)
+		}
+		if !reflect.DeepEqual(chain, tt.chain) {
+			t.Errorf("ExplainRuleMatch(%s:%d) chain = %q, want %q", tt.req.Host, tt.req.Port, chain, tt.chain)
+		}
+	}
+}
+
+// 域名目标遇到未设置 no-resolve 的 IP 规则时需要解析域名，无法判定
+func TestExplainRuleMatchNeedsResolve(t *testing.T) {
+	result, err := ExplainRuleMatch(ExplainRequest{
+		Config: "rules:\n  - IP-CIDR,10.0.0.0/8,DIRECT\n  - MATCH,Proxy\n",
+		Host:   "example.com",
+	})
+	if err != nil {
+		t.Fatalf("ExplainRuleMatch() error = %v", err)
+	}
+	if result.Matched != nil || ruleIndex(result.Undetermined) != 0 {
+		t.Errorf("ExplainRuleMatch() = %+v, want undetermined at 0", result)
+	}
+
+	result, err = ExplainRuleMatch(ExplainRequest{
+		Config: "rules:\n  - IP-CIDR,10.0.0.0/8,DIRECT\n  - MATCH,Proxy\n",
+		Host:   "example.com",
+		IP:     "93.184.216.34",
+	})
+	if err != nil || ruleIndex(result.Matched) != 1 {
+		t.Errorf("ExplainRuleMatch() = %+v, %v, want matched at 1", result, err)
+	}
+}
+
+func ruleIndex(rule *ExplainRule) int {
+	if rule == nil {
+		return -1
+	}
+	return rule.Index
+}
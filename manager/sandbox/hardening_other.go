@@ -0,0 +1,15 @@
+//go:build !linux || !(amd64 || arm64)
+
+package sandbox
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func prepareHardening(_ string) (func() error, Hardening) {
+	return nil, Hardening{
+		Level:   HardeningNone,
+		Reasons: []string{fmt.Sprintf("不支持 seccomp 与 Landlock 的平台: %s/%s", runtime.GOOS, runtime.GOARCH)},
+	}
+}
@@ -0,0 +1,45 @@
+//go:build linux || darwin
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// helperPath 为 testdata/helper 静态编译后的路径，沙盒根目录中没有动态链接库
+var helperPath string
+
+func TestMain(m *testing.M) {
+	// 不使用 sandbox- 前缀，避免被清理遗留沙盒时删除
+	dir, err := os.MkdirTemp("", "sparkle-helper-*")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	helperPath = filepath.Join(dir, "helper")
+	build := exec.Command("go", "build", "-o", helperPath, "./testdata/helper")
+	build.Env = append(os.Environ(), "CGO_ENABLED=0")
+	if output, err := build.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "编译测试程序失败: %v\n%s", err, output)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func helperConfig(t *testing.T, args ...string) Config {
+	return Config{
+		BinaryPath: helperPath,
+		BinaryName: "helper",
+		WorkDir:    t.TempDir(),
+		Args:       args,
+		Purpose:    "test",
+	}
+}
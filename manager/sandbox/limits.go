@@ -0,0 +1,100 @@
+package sandbox
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// 未指定时输出捕获的上限
+const defaultOutputLimit = 1 << 20
+
+// Limits 限制沙盒进程可使用的资源，零值表示不限制
+type Limits struct {
+	// MemoryBytes 内存上限，优先使用 cgroup，否则回退到 RLIMIT_DATA
+	MemoryBytes uint64
+	// CPUTime CPU 时间上限
+	CPUTime time.Duration
+	// FileSize 单个文件大小上限
+	FileSize uint64
+	// Processes 进程与线程总数上限，仅在 cgroup v2 可用时生效。
+	// RLIMIT_NPROC 按 UID 统计全部进程，无法只限制沙盒的进程树，因此不作为回退
+	Processes uint64
+	// WallClock 运行时长上限，超时后强制结束
+	WallClock time.Duration
+	// OutputBytes 输出捕获上限，默认 1 MiB
+	OutputBytes int
+}
+
+const (
+	ExitNormal  = "normal"
+	ExitSignal  = "signal"
+	ExitTimeout = "timeout"
+	ExitLimit   = "limit"
+)
+
+const (
+	LimitMemory    = "memory"
+	LimitCPU       = "cpu"
+	LimitFileSize  = "file_size"
+	LimitProcesses = "processes"
+)
+
+// Result 描述沙盒进程的退出情况
+type Result struct {
+	Reason    string `json:"reason"`
+	ExitCode  int    `json:"exit_code"`
+	Signal    string `json:"signal,omitempty"`
+	Limit     string `json:"limit,omitempty"`
+	ElapsedMs int64  `json:"elapsed_ms"`
+	Output    string `json:"output"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated"`
+	// Files 为 Run 收集到的输出文件
+	Files map[string][]byte `json:"files,omitempty"`
+}
+
+// OutputBuffer 并发安全地捕获进程输出，超出上限的部分被丢弃
+type OutputBuffer struct {
+	mutex     sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func newOutputBuffer(limit int) *OutputBuffer {
+	if limit <= 0 {
+		limit = defaultOutputLimit
+	}
+	return &OutputBuffer{limit: limit}
+}
+
+func (b *OutputBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	remain := b.limit - b.buf.Len()
+	if remain < len(p) {
+		b.truncated = true
+		if remain > 0 {
+			b.buf.Write(p[:remain])
+		}
+		// 丢弃超出部分，避免子进程因写入失败而阻塞
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *OutputBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+// Truncated 报告输出是否因超出上限而被截断
+func (b *OutputBuffer) Truncated() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.truncated
+}
@@ -0,0 +1,422 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// cgroupParent 为服务 cgroup 下存放沙盒 cgroup 的目录
+const cgroupParent = "sparkle-sandbox"
+
+// resourceLimiter 通过 cgroup v2 与 rlimit 限制子进程资源。
+// rlimit 为进程级属性，无法只在启动线程上设置，因此子进程以 ptrace 方式启动，
+// 在 exec 后的第一条指令之前停下，设置完 rlimit 再继续运行
+type resourceLimiter struct {
+	limits   Limits
+	cgroup   string
+	cgroupFd int
+	// traced 表示子进程在 exec 后停止，等待 attach 设置 rlimit
+	traced bool
+}
+
+type rlimit struct {
+	resource int
+	cur, max uint64
+}
+
+func newResourceLimiter(limits Limits) *resourceLimiter {
+	l := &resourceLimiter{limits: limits, cgroupFd: -1}
+	if limits.MemoryBytes == 0 && limits.Processes == 0 {
+		return l
+	}
+
+	dir, err := createCgroup(limits)
+	if err != nil {
+		printCgroupFallback(limits, err)
+		return l
+	}
+	fd, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		activeMutex.Lock()
+		delete(activeCgroups, dir)
+		activeMutex.Unlock()
+		os.Remove(dir)
+		printCgroupFallback(limits, err)
+		return l
+	}
+	l.cgroup = dir
+	l.cgroupFd = fd
+	return l
+}
+
+// printCgroupFallback 说明 cgroup 不可用时的限制方式。RLIMIT_NPROC 统计的是
+// 同一 UID 的全部进程而非沙盒的进程树，因此不作为进程数限制的回退
+func printCgroupFallback(limits Limits, err error) {
+	if limits.MemoryBytes > 0 {
+		fmt.Printf("cgroup 不可用，内存限制改用 rlimit: %v\n", err)
+	}
+	if limits.Processes > 0 {
+		fmt.Printf("cgroup 不可用，不限制进程数: %v\n", err)
+	}
+}
+
+// cgroupControllers 为沙盒 cgroup 需要的控制器
+var cgroupControllers = []string{"memory", "pids"}
+
+var (
+	// cgroupRoot 与 selfCgroupFile 可在测试中替换为模拟的目录
+	cgroupRoot     = "/sys/fs/cgroup"
+	selfCgroupFile = "/proc/self/cgroup"
+
+	cgroupParentOnce sync.Once
+	cgroupParentDir  string
+	cgroupParentErr  error
+
+	activeMutex   sync.Mutex
+	activeCgroups = map[string]bool{}
+)
+
+// sandboxCgroupParent 返回沙盒 cgroup 的父目录，只在服务自身的 cgroup 子树中启用控制器
+func sandboxCgroupParent() (string, error) {
+	cgroupParentOnce.Do(func() {
+		cgroupParentDir, cgroupParentErr = prepareCgroupParent()
+	})
+	return cgroupParentDir, cgroupParentErr
+}
+
+// prepareCgroupParent 在服务所在的 cgroup 下创建 cgroupParent 并启用控制器，不修改根 cgroup。
+// cgroup v2 中有进程的非根 cgroup 不能向子 cgroup 启用控制器，因此先将服务进程移入同级的叶子 cgroup；
+// 服务位于根 cgroup 时只使用根 cgroup 已启用的控制器
+func prepareCgroupParent() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("未启用 cgroup v2")
+	}
+	own, err := serviceCgroup()
+	if err != nil {
+		return "", err
+	}
+
+	if own == cgroupRoot {
+		if err := checkControllers(own, "cgroup.subtree_control"); err != nil {
+			return "", err
+		}
+	} else {
+		if err := checkControllers(own, "cgroup.controllers"); err != nil {
+			return "", err
+		}
+		leaf := filepath.Join(own, "service")
+		if err := os.MkdirAll(leaf, 0o755); err != nil {
+			return "", fmt.Errorf("创建 cgroup 失败: %w", err)
+		}
+		if err := writeCgroupFile(leaf, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+			return "", err
+		}
+		if err := enableControllers(own); err != nil {
+			return "", err
+		}
+	}
+
+	parent := filepath.Join(own, cgroupParent)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return "", fmt.Errorf("创建 cgroup 失败: %w", err)
+	}
+	if err := enableControllers(parent); err != nil {
+		return "", err
+	}
+	return parent, nil
+}
+
+// serviceCgroup 返回服务进程所在的 cgroup v2 目录
+func serviceCgroup() (string, error) {
+	data, err := os.ReadFile(selfCgroupFile)
+	if err != nil {
+		return "", fmt.Errorf("读取进程 cgroup 失败: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Join(cgroupRoot, path), nil
+		}
+	}
+	return "", fmt.Errorf("进程不在 cgroup v2 中")
+}
+
+// checkControllers 检查 cgroup 的控制器列表文件中包含沙盒需要的控制器
+func checkControllers(dir, name string) error {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败: %w", name, err)
+	}
+	available := strings.Fields(strings.ReplaceAll(string(data), "+", ""))
+	for _, controller := range cgroupControllers {
+		if !slices.Contains(available, controller) {
+			return fmt.Errorf("%s 的 %s 中没有 %s 控制器", dir, name, controller)
+		}
+	}
+	return nil
+}
+
+// enableControllers 向子 cgroup 启用沙盒需要的控制器
+func enableControllers(dir string) error {
+	value := "+" + strings.Join(cgroupControllers, " +")
+	if err := writeCgroupFile(dir, "cgroup.subtree_control", value); err != nil {
+		return err
+	}
+	return checkControllers(dir, "cgroup.subtree_control")
+}
+
+// createCgroup 为本次运行创建子 cgroup 并写入限制
+func createCgroup(limits Limits) (string, error) {
+	parent, err := sandboxCgroupParent()
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(parent, "run-*")
+	if err != nil {
+		return "", fmt.Errorf("创建 cgroup 失败: %w", err)
+	}
+
+	if limits.MemoryBytes > 0 {
+		if err := writeCgroupFile(dir, "memory.max", strconv.FormatUint(limits.MemoryBytes, 10)); err != nil {
+			os.Remove(dir)
+			return "", err
+		}
+		writeCgroupFile(dir, "memory.swap.max", "0")
+	}
+	if limits.Processes > 0 {
+		if err := writeCgroupFile(dir, "pids.max", strconv.FormatUint(limits.Processes, 10)); err != nil {
+			os.Remove(dir)
+			return "", err
+		}
+	}
+
+	activeMutex.Lock()
+	activeCgroups[dir] = true
+	activeMutex.Unlock()
+	return dir, nil
+}
+
+// sweepCgroups 删除服务异常退出后遗留的沙盒 cgroup，仍有进程时先将其结束
+func sweepCgroups() {
+	parent, err := sandboxCgroupParent()
+	if err != nil {
+		return
+	}
+	dirs, err := filepath.Glob(filepath.Join(parent, "run-*"))
+	if err != nil {
+		return
+	}
+	for _, dir := range dirs {
+		activeMutex.Lock()
+		active := activeCgroups[dir]
+		activeMutex.Unlock()
+		if active {
+			continue
+		}
+
+		if procs, err := os.ReadFile(filepath.Join(dir, "cgroup.procs")); err == nil && len(strings.TrimSpace(string(procs))) > 0 {
+			// 进程退出后才能删除，删除失败时留待下次清理
+			writeCgroupFile(dir, "cgroup.kill", "1")
+		}
+		if err := os.Remove(dir); err != nil {
+			fmt.Printf("清理 cgroup %s 失败: %v\n", dir, err)
+			continue
+		}
+		fmt.Println("已清理遗留的 cgroup:", dir)
+	}
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0o644); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", name, err)
+	}
+	return nil
+}
+
+// readCgroupEvent 读取 cgroup 事件文件中指定键的计数
+func readCgroupEvent(dir, name, key string) uint64 {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			n, _ := strconv.ParseUint(fields[1], 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+// prepare 在启动前设置子进程直接创建于 cgroup 中，需要 rlimit 时以 ptrace 方式启动
+func (l *resourceLimiter) prepare(cmd *exec.Cmd) {
+	if l.cgroupFd < 0 && len(l.rlimits()) == 0 {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if l.cgroupFd >= 0 {
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = l.cgroupFd
+	}
+	if len(l.rlimits()) > 0 {
+		if err := ptraceAllowed(); err != nil {
+			fmt.Printf("无法在 exec 前设置 rlimit，改为启动后设置: %v\n", err)
+			return
+		}
+		cmd.SysProcAttr.Ptrace = true
+		l.traced = true
+	}
+}
+
+// ptraceAllowed 检查 Yama 是否允许子进程请求被父进程跟踪
+func ptraceAllowed() error {
+	data, err := os.ReadFile("/proc/sys/kernel/yama/ptrace_scope")
+	if err != nil {
+		return nil
+	}
+	switch strings.TrimSpace(string(data)) {
+	case "2":
+		if os.Geteuid() != 0 {
+			return fmt.Errorf("ptrace_scope 为 2，需要 root 权限")
+		}
+	case "3":
+		return fmt.Errorf("ptrace_scope 为 3，已禁用 ptrace")
+	}
+	return nil
+}
+
+// rlimits 返回需要设置的 rlimit，内存在 cgroup 不可用时回退到 RLIMIT_DATA
+func (l *resourceLimiter) rlimits() []rlimit {
+	var list []rlimit
+	if l.limits.CPUTime > 0 {
+		secs := uint64(l.limits.CPUTime.Seconds())
+		if secs == 0 {
+			secs = 1
+		}
+		// 软限制触发 SIGXCPU，硬限制兜底 SIGKILL
+		list = append(list, rlimit{unix.RLIMIT_CPU, secs, secs + 1})
+	}
+	if l.limits.FileSize > 0 {
+		list = append(list, rlimit{unix.RLIMIT_FSIZE, l.limits.FileSize, l.limits.FileSize})
+	}
+	if l.cgroup == "" && l.limits.MemoryBytes > 0 {
+		// Go 运行时预留的地址空间较大，使用 RLIMIT_DATA 而非 RLIMIT_AS
+		list = append(list, rlimit{unix.RLIMIT_DATA, l.limits.MemoryBytes, l.limits.MemoryBytes})
+	}
+	return list
+}
+
+// attach 在子进程执行前设置 rlimit，需在启动子进程的线程上调用。
+// 以 ptrace 方式启动的子进程在 exec 后停止，设置完成后解除跟踪使其继续运行
+func (l *resourceLimiter) attach(pid int) error {
+	if l.traced {
+		var status unix.WaitStatus
+		if _, err := unix.Wait4(pid, &status, 0, nil); err != nil {
+			return fmt.Errorf("等待子进程停止失败: %w", err)
+		}
+		if !status.Stopped() {
+			return fmt.Errorf("子进程在设置资源限制前已退出")
+		}
+	}
+
+	var err error
+	for _, limit := range l.rlimits() {
+		if err = setRlimit(pid, limit.resource, limit.cur, limit.max); err != nil {
+			break
+		}
+	}
+	if !l.traced {
+		return err
+	}
+	if err != nil {
+		// 未能设置限制时不让子进程继续运行
+		unix.Kill(pid, unix.SIGKILL)
+		return err
+	}
+	if err := unix.PtraceDetach(pid); err != nil {
+		return fmt.Errorf("解除跟踪失败: %w", err)
+	}
+	return nil
+}
+
+func setRlimit(pid, resource int, cur, max uint64) error {
+	limit := unix.Rlimit{Cur: cur, Max: max}
+	if err := unix.Prlimit(pid, resource, &limit, nil); err != nil {
+		return fmt.Errorf("设置资源限制失败: %w", err)
+	}
+	return nil
+}
+
+// exceeded 根据退出状态、资源用量与 cgroup 事件判断触发的限制
+func (l *resourceLimiter) exceeded(state *os.ProcessState, output string) string {
+	status, _ := state.Sys().(syscall.WaitStatus)
+	if status.Exited() && status.ExitStatus() == 0 {
+		return ""
+	}
+
+	if status.Signaled() {
+		switch status.Signal() {
+		case syscall.SIGXCPU:
+			return LimitCPU
+		case syscall.SIGXFSZ:
+			return LimitFileSize
+		case syscall.SIGKILL:
+			// Go 程序忽略 SIGXCPU，由硬限制的 SIGKILL 结束
+			if l.limits.CPUTime > 0 && state.UserTime()+state.SystemTime() >= l.limits.CPUTime {
+				return LimitCPU
+			}
+		}
+	}
+
+	// Go 程序忽略 SIGXFSZ，写入超限时得到 EFBIG
+	if l.limits.FileSize > 0 && strings.Contains(output, "file too large") {
+		return LimitFileSize
+	}
+	if l.cgroup == "" {
+		// rlimit 下内存耗尽表现为运行时分配失败
+		if l.limits.MemoryBytes > 0 && (strings.Contains(output, "cannot allocate memory") ||
+			strings.Contains(output, "fatal error: out of memory")) {
+			return LimitMemory
+		}
+		return ""
+	}
+	if readCgroupEvent(l.cgroup, "memory.events", "oom_kill") > 0 {
+		return LimitMemory
+	}
+	if readCgroupEvent(l.cgroup, "pids.events", "max") > 0 {
+		return LimitProcesses
+	}
+	return ""
+}
+
+func (l *resourceLimiter) close() error {
+	if l.cgroupFd < 0 {
+		return nil
+	}
+	unix.Close(l.cgroupFd)
+	l.cgroupFd = -1
+	activeMutex.Lock()
+	delete(activeCgroups, l.cgroup)
+	activeMutex.Unlock()
+	if err := os.Remove(l.cgroup); err != nil {
+		return fmt.Errorf("删除 cgroup 失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRlimitsBeforeExec(t *testing.T) {
+	for _, harden := range []bool{false, true} {
+		cfg := helperConfig(t, "rlimits")
+		cfg.Harden = harden
+		cfg.Limits = Limits{CPUTime: 5 * time.Second, FileSize: 1 << 20}
+
+		res, err := Run(context.Background(), cfg)
+		if err != nil {
+			t.Fatalf("Run(harden=%v) error = %v", harden, err)
+		}
+		if got, want := strings.TrimSpace(res.Stdout), "cpu=5 fsize=1048576"; got != want {
+			t.Errorf("harden=%v 时进程启动时的资源限制 = %q, want %q", harden, got, want)
+		}
+	}
+}
+
+func TestFileSizeLimit(t *testing.T) {
+	cfg := helperConfig(t, "write", "65536")
+	cfg.Limits = Limits{FileSize: 4096}
+
+	res, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.Reason != ExitLimit || res.Limit != LimitFileSize {
+		t.Errorf("Result = %+v, want 触发 file_size 限制", res)
+	}
+}
+
+func TestWallClockLimit(t *testing.T) {
+	cfg := helperConfig(t, "sleep")
+	cfg.Limits = Limits{WallClock: 200 * time.Millisecond}
+
+	res, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.Reason != ExitTimeout {
+		t.Errorf("Result = %+v, want 超时", res)
+	}
+}
+
+// fakeCgroupTree 构造模拟的 cgroup v2 目录，服务进程位于 own 下
+func fakeCgroupTree(t *testing.T, own string) string {
+	root := t.TempDir()
+	writeFile := func(path, data string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(filepath.Join(root, "cgroup.controllers"), "cpu memory pids\n")
+	writeFile(filepath.Join(root, "cgroup.subtree_control"), "cpu\n")
+	writeFile(filepath.Join(root, own, "cgroup.controllers"), "memory pids\n")
+	selfCgroup := filepath.Join(t.TempDir(), "cgroup")
+	writeFile(selfCgroup, "0::/"+own+"\n")
+
+	oldRoot, oldSelf := cgroupRoot, selfCgroupFile
+	cgroupRoot, selfCgroupFile = root, selfCgroup
+	cgroupParentOnce = sync.Once{}
+	t.Cleanup(func() {
+		cgroupRoot, selfCgroupFile = oldRoot, oldSelf
+		cgroupParentOnce = sync.Once{}
+	})
+	return root
+}
+
+func TestCgroupParentUnderServiceCgroup(t *testing.T) {
+	root := fakeCgroupTree(t, "system.slice/sparkle.service")
+	own := filepath.Join(root, "system.slice/sparkle.service")
+
+	parent, err := sandboxCgroupParent()
+	if err != nil {
+		t.Fatalf("sandboxCgroupParent() error = %v", err)
+	}
+	if want := filepath.Join(own, cgroupParent); parent != want {
+		t.Errorf("sandboxCgroupParent() = %q, want %q", parent, want)
+	}
+	for path, want := range map[string]string{
+		filepath.Join(root, "cgroup.subtree_control"):   "cpu\n",
+		filepath.Join(own, "cgroup.subtree_control"):    "+memory +pids",
+		filepath.Join(own, "service", "cgroup.procs"):   strconv.Itoa(os.Getpid()),
+		filepath.Join(parent, "cgroup.subtree_control"): "+memory +pids",
+	} {
+		if got, err := os.ReadFile(path); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v, want %q", path, got, err, want)
+		}
+	}
+}
+
+// 服务位于根 cgroup 时不修改根 cgroup，控制器未启用则回退
+func TestCgroupParentAtRoot(t *testing.T) {
+	root := fakeCgroupTree(t, "")
+	if _, err := sandboxCgroupParent(); err == nil {
+		t.Fatal("sandboxCgroupParent() 未在根 cgroup 缺少控制器时返回错误")
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, "cgroup.subtree_control")); string(got) != "cpu\n" {
+		t.Errorf("根 cgroup.subtree_control = %q, 不应被修改", got)
+	}
+}
+
+func TestSweepCgroups(t *testing.T) {
+	fakeCgroupTree(t, "sparkle.service")
+	dir, err := createCgroup(Limits{Processes: 16})
+	if err != nil {
+		t.Fatalf("createCgroup() error = %v", err)
+	}
+	t.Cleanup(func() {
+		activeMutex.Lock()
+		delete(activeCgroups, dir)
+		activeMutex.Unlock()
+	})
+	// 模拟的目录中无法自动移除 cgroup 接口文件，只保留空目录表示遗留的 cgroup
+	for _, name := range []string{"memory.max", "memory.swap.max", "pids.max"} {
+		os.Remove(filepath.Join(dir, name))
+	}
+	stale := filepath.Join(filepath.Dir(dir), "run-stale")
+	if err := os.Mkdir(stale, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	sweepCgroups()
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("遗留的 cgroup 未被清理: %v", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("仍在使用的 cgroup 被清理: %v", err)
+	}
+}
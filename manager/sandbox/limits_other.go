@@ -0,0 +1,31 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+)
+
+// resourceLimiter 在非 Linux 平台上仅支持运行时长与输出限制
+type resourceLimiter struct{}
+
+func newResourceLimiter(_ Limits) *resourceLimiter {
+	return &resourceLimiter{}
+}
+
+func (l *resourceLimiter) prepare(_ *exec.Cmd) {}
+
+func (l *resourceLimiter) attach(_ int) error {
+	return nil
+}
+
+func (l *resourceLimiter) exceeded(_ *os.ProcessState, _ string) string {
+	return ""
+}
+
+func (l *resourceLimiter) close() error {
+	return nil
+}
+
+func sweepCgroups() {}
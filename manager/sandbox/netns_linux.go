@@ -0,0 +1,233 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const forwardDialTimeout = 5 * time.Second
+
+// netNamespace 为沙盒创建独立的网络命名空间，仅启用回环网卡
+type netNamespace struct {
+	fd        int
+	mutex     sync.Mutex
+	listeners []net.Listener
+}
+
+// NetworkIsolationSupported 报告当前进程能否创建网络命名空间
+func NetworkIsolationSupported() bool {
+	return os.Geteuid() == 0
+}
+
+func newNetNamespace() (*netNamespace, error) {
+	if !NetworkIsolationSupported() {
+		return nil, fmt.Errorf("创建网络命名空间需要 root 权限")
+	}
+
+	type result struct {
+		fd  int
+		err error
+	}
+	done := make(chan result, 1)
+
+	// 在独立的线程中创建命名空间，线程无法恢复时随 goroutine 退出
+	go func() {
+		runtime.LockOSThread()
+
+		origin, err := openThreadNetNS()
+		if err != nil {
+			runtime.UnlockOSThread()
+			done <- result{err: err}
+			return
+		}
+		defer unix.Close(origin)
+
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			done <- result{err: fmt.Errorf("创建网络命名空间失败: %w", err)}
+			return
+		}
+
+		fd, err := openThreadNetNS()
+		if err == nil {
+			if err = setLoopbackUp(); err != nil {
+				unix.Close(fd)
+			}
+		}
+
+		if restoreErr := unix.Setns(origin, unix.CLONE_NEWNET); restoreErr != nil {
+			if err == nil {
+				unix.Close(fd)
+			}
+			done <- result{err: fmt.Errorf("恢复网络命名空间失败: %w", restoreErr)}
+			return
+		}
+		runtime.UnlockOSThread()
+		done <- result{fd: fd, err: err}
+	}()
+
+	res := <-done
+	if res.err != nil {
+		return nil, res.err
+	}
+	return &netNamespace{fd: res.fd}, nil
+}
+
+func openThreadNetNS() (int, error) {
+	path := fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), unix.Gettid())
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("打开网络命名空间失败: %w", err)
+	}
+	return fd, nil
+}
+
+func setLoopbackUp() error {
+	sock, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("创建套接字失败: %w", err)
+	}
+	defer unix.Close(sock)
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(sock, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("读取回环网卡状态失败: %w", err)
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	if err := unix.IoctlIfreq(sock, unix.SIOCSIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("启用回环网卡失败: %w", err)
+	}
+	return nil
+}
+
+// run 在命名空间内的线程上执行 fn，在其中创建的套接字属于该命名空间
+func (n *netNamespace) run(fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		origin, err := openThreadNetNS()
+		if err != nil {
+			runtime.UnlockOSThread()
+			done <- err
+			return
+		}
+		defer unix.Close(origin)
+
+		if err := n.enter(); err != nil {
+			runtime.UnlockOSThread()
+			done <- err
+			return
+		}
+
+		fnErr := fn()
+		if err := unix.Setns(origin, unix.CLONE_NEWNET); err != nil {
+			done <- fmt.Errorf("恢复网络命名空间失败: %w", err)
+			return
+		}
+		runtime.UnlockOSThread()
+		done <- fnErr
+	}()
+	return <-done
+}
+
+// enter 将当前线程切换到命名空间中，调用方需已锁定线程
+func (n *netNamespace) enter() error {
+	if err := unix.Setns(n.fd, unix.CLONE_NEWNET); err != nil {
+		return fmt.Errorf("进入网络命名空间失败: %w", err)
+	}
+	return nil
+}
+
+func (n *netNamespace) dial(addr string) (net.Conn, error) {
+	var conn net.Conn
+	err := n.run(func() error {
+		var err error
+		conn, err = net.DialTimeout("tcp", addr, forwardDialTimeout)
+		return err
+	})
+	return conn, err
+}
+
+// listen 在命名空间内的回环地址上监听，沙盒中的进程可以连接
+func (n *netNamespace) listen() (net.Listener, error) {
+	var l net.Listener
+	err := n.run(func() error {
+		var err error
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("端口获取失败: %w", err)
+	}
+	return l, nil
+}
+
+// forward 在宿主回环地址上监听，并将连接转发到命名空间内的端口
+func (n *netNamespace) forward(port int) (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("端口获取失败: %w", err)
+	}
+
+	n.mutex.Lock()
+	n.listeners = append(n.listeners, l)
+	n.mutex.Unlock()
+
+	target := fmt.Sprintf("127.0.0.1:%d", port)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go n.pipe(conn, target)
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (n *netNamespace) pipe(conn net.Conn, target string) {
+	defer conn.Close()
+
+	upstream, err := n.dial(target)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func (n *netNamespace) close() error {
+	n.mutex.Lock()
+	for _, l := range n.listeners {
+		l.Close()
+	}
+	n.listeners = nil
+	n.mutex.Unlock()
+
+	return unix.Close(n.fd)
+}
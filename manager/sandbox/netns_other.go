@@ -0,0 +1,36 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+type netNamespace struct{}
+
+// NetworkIsolationSupported 报告当前进程能否创建网络命名空间
+func NetworkIsolationSupported() bool {
+	return false
+}
+
+func newNetNamespace() (*netNamespace, error) {
+	return nil, fmt.Errorf("不支持网络隔离的操作系统: %s", runtime.GOOS)
+}
+
+func (n *netNamespace) enter() error {
+	return nil
+}
+
+func (n *netNamespace) listen() (net.Listener, error) {
+	return net.Listen("tcp", "127.0.0.1:0")
+}
+
+func (n *netNamespace) forward(port int) (int, error) {
+	return port, nil
+}
+
+func (n *netNamespace) close() error {
+	return nil
+}
@@ -0,0 +1,242 @@
+package sandbox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Pool 缓存预先创建并已放入核心二进制的沙盒根目录，进程结束后清理并复用
+type Pool struct {
+	mutex   sync.Mutex
+	size    int
+	idle    []*pooledRoot
+	filling bool
+	closed  bool
+}
+
+// binaryDigest 缓存二进制的摘要，大小与修改时间不变时不重新计算
+type binaryDigest struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+var (
+	digestMutex sync.Mutex
+	digests     = map[string]binaryDigest{}
+)
+
+type pooledRoot struct {
+	key  string
+	cfg  Config
+	root *sandboxRoot
+}
+
+func NewPool(size int) *Pool {
+	return &Pool{size: max(size, 0)}
+}
+
+func poolKey(orig Config) (string, error) {
+	binPath, err := filepath.Abs(orig.BinaryPath)
+	if err != nil {
+		return "", fmt.Errorf("解析二进制路径失败: %w", err)
+	}
+	workDir, err := filepath.Abs(orig.WorkDir)
+	if err != nil {
+		return "", fmt.Errorf("解析工作目录失败: %w", err)
+	}
+	sum, err := digestBinary(binPath)
+	if err != nil {
+		return "", err
+	}
+	// 二进制被替换后旧的根目录中仍是旧的副本，不能再复用
+	return binPath + "\x00" + sum + "\x00" + workDir, nil
+}
+
+// digestBinary 计算二进制的 SHA-256
+func digestBinary(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("读取二进制失败: %w", err)
+	}
+
+	digestMutex.Lock()
+	cached, ok := digests[path]
+	digestMutex.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("读取二进制失败: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("读取二进制失败: %w", err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	digestMutex.Lock()
+	digests[path] = binaryDigest{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	digestMutex.Unlock()
+	return sum, nil
+}
+
+// Resize 调整缓存数量，多余的根目录立即删除
+func (p *Pool) Resize(size int) {
+	p.mutex.Lock()
+	p.size = max(size, 0)
+	var extra []*pooledRoot
+	if len(p.idle) > p.size {
+		extra = p.idle[p.size:]
+		p.idle = p.idle[:p.size]
+	}
+	p.mutex.Unlock()
+
+	for _, r := range extra {
+		r.destroy()
+	}
+}
+
+// Warm 在后台补足与 orig 对应的根目录，二进制或工作目录变化时替换旧的缓存
+func (p *Pool) Warm(orig Config) {
+	key, err := poolKey(orig)
+	if err != nil {
+		return
+	}
+
+	p.mutex.Lock()
+	if p.filling || p.closed {
+		p.mutex.Unlock()
+		return
+	}
+	p.filling = true
+	var stale []*pooledRoot
+	idle := p.idle[:0]
+	for _, r := range p.idle {
+		if r.key == key {
+			idle = append(idle, r)
+		} else {
+			stale = append(stale, r)
+		}
+	}
+	p.idle = idle
+	p.mutex.Unlock()
+
+	for _, r := range stale {
+		r.destroy()
+	}
+
+	go func() {
+		defer func() {
+			p.mutex.Lock()
+			p.filling = false
+			p.mutex.Unlock()
+		}()
+
+		for {
+			p.mutex.Lock()
+			full := p.closed || len(p.idle) >= p.size
+			p.mutex.Unlock()
+			if full {
+				return
+			}
+
+			cfg, root, err := createSandbox(orig)
+			if err != nil {
+				fmt.Printf("预创建沙盒失败: %v\n", err)
+				return
+			}
+			if !p.put(&pooledRoot{key: key, cfg: cfg, root: root}) {
+				return
+			}
+		}
+	}()
+}
+
+// put 将根目录放回缓存，缓存已满或已关闭时删除
+func (p *Pool) put(r *pooledRoot) bool {
+	// 空闲的根目录同样需要标记，服务异常退出后由清理任务删除
+	writeMarker(r.root.dir, marker{Owner: os.Getpid(), Purpose: "pool", CreatedAt: time.Now()})
+
+	p.mutex.Lock()
+	if p.closed || len(p.idle) >= p.size {
+		p.mutex.Unlock()
+		r.destroy()
+		return false
+	}
+	retain(r.root.dir)
+	p.idle = append(p.idle, r)
+	p.mutex.Unlock()
+	return true
+}
+
+// take 取出与 orig 匹配的根目录，没有时新建，归还时清理后放回缓存
+func (p *Pool) take(orig Config) (Config, *sandboxRoot, error) {
+	key, err := poolKey(orig)
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	var r *pooledRoot
+	p.mutex.Lock()
+	for i, candidate := range p.idle {
+		if candidate.key == key {
+			r = candidate
+			p.idle = append(p.idle[:i], p.idle[i+1:]...)
+			break
+		}
+	}
+	p.mutex.Unlock()
+
+	if r == nil {
+		cfg, root, err := createSandbox(orig)
+		if err != nil {
+			return Config{}, nil, err
+		}
+		r = &pooledRoot{key: key, cfg: cfg, root: root}
+		retain(root.dir)
+	}
+	p.Warm(orig)
+
+	cfg := r.cfg
+	cfg.Args = orig.Args
+	root := *r.root
+	root.cleanup = func() error {
+		if err := r.root.scrub(); err != nil {
+			fmt.Printf("清理沙盒失败，不再复用: %v\n", err)
+			return r.root.cleanup()
+		}
+		p.put(r)
+		return nil
+	}
+	return cfg, &root, nil
+}
+
+// Close 删除所有缓存的根目录，之后归还的根目录直接删除
+func (p *Pool) Close() {
+	p.mutex.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mutex.Unlock()
+
+	for _, r := range idle {
+		r.destroy()
+	}
+}
+
+func (r *pooledRoot) destroy() {
+	unretain(r.root.dir)
+	if err := r.root.cleanup(); err != nil {
+		fmt.Printf("删除沙盒失败: %v\n", err)
+	}
+}
@@ -0,0 +1,34 @@
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPoolKeyChangesWithBinary(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "core")
+	if err := os.WriteFile(bin, []byte("v1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	orig := Config{BinaryPath: bin, WorkDir: t.TempDir()}
+	before, err := poolKey(orig)
+	if err != nil {
+		t.Fatalf("poolKey() error = %v", err)
+	}
+
+	// 原地替换为大小相同的新版本
+	info, _ := os.Stat(bin)
+	if err := os.WriteFile(bin, []byte("v2"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(bin, info.ModTime().Add(time.Second), info.ModTime().Add(time.Second))
+	after, err := poolKey(orig)
+	if err != nil {
+		t.Fatalf("poolKey() error = %v", err)
+	}
+	if before == after {
+		t.Error("替换二进制后 poolKey() 未变化")
+	}
+}
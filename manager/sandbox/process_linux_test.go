@@ -0,0 +1,81 @@
+package sandbox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sandboxProcesses 统计宿主上环境变量中带有沙盒标识的进程
+func sandboxProcesses(id string) int {
+	marker := []byte(envMarker + "=" + id + "\x00")
+	paths, _ := filepath.Glob("/proc/[0-9]*/environ")
+	count := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err == nil && bytes.Contains(data, marker) {
+			count++
+		}
+	}
+	return count
+}
+
+// startTree 启动派生子进程与孙进程的沙盒进程，等待全部就绪
+func startTree(t *testing.T, args ...string) *SandboxedProcess {
+	t.Helper()
+	p, err := NewSandboxedProcess(helperConfig(t, append([]string{"tree"}, args...)...))
+	if err != nil {
+		t.Fatalf("NewSandboxedProcess() error = %v", err)
+	}
+	t.Cleanup(func() { p.Kill() })
+	if err := p.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(p.StdoutBuffer().String(), "ready") {
+		if time.Now().After(deadline) {
+			t.Fatalf("进程树未就绪，输出 %q", p.StdoutBuffer().String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return p
+}
+
+func TestProcessTreeKill(t *testing.T) {
+	p := startTree(t)
+	if n := sandboxProcesses(p.ID()); n != 3 {
+		t.Fatalf("进程数 = %d, want 3", n)
+	}
+	if err := p.Kill(); err != nil {
+		t.Fatalf("Kill() error = %v", err)
+	}
+	if n := sandboxProcesses(p.ID()); n != 0 {
+		t.Errorf("Kill() 后仍有 %d 个进程", n)
+	}
+}
+
+func TestProcessTreeStop(t *testing.T) {
+	p := startTree(t)
+	if n := sandboxProcesses(p.ID()); n != 3 {
+		t.Fatalf("进程数 = %d, want 3", n)
+	}
+	if err := p.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if n := sandboxProcesses(p.ID()); n != 0 {
+		t.Errorf("Stop() 后仍有 %d 个进程", n)
+	}
+}
+
+func TestProcessTreeMainExit(t *testing.T) {
+	p := startTree(t, "exit")
+	if _, err := p.Wait(); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if n := sandboxProcesses(p.ID()); n != 0 {
+		t.Errorf("主进程退出后仍有 %d 个进程", n)
+	}
+}
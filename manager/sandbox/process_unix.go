@@ -0,0 +1,29 @@
+//go:build linux || darwin
+
+package sandbox
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// processTree 为以子进程为首的进程组，结束时整组发送信号
+type processTree struct {
+	pid int
+}
+
+func newProcessTree(cmd *exec.Cmd) *processTree {
+	return &processTree{pid: cmd.Process.Pid}
+}
+
+func (t *processTree) signal(sig syscall.Signal) error {
+	return syscall.Kill(-t.pid, sig)
+}
+
+func (t *processTree) kill() error {
+	return syscall.Kill(-t.pid, syscall.SIGKILL)
+}
+
+func (t *processTree) close() error {
+	return nil
+}
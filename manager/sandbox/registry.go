@@ -0,0 +1,218 @@
+package sandbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// markerFile 记录沙盒归属，位于临时目录中、沙盒根目录之外
+	markerFile = ".sparkle-sandbox.json"
+	// envMarker 注入到沙盒进程环境变量中，用于识别孤儿进程
+	envMarker = "SPARKLE_SANDBOX"
+)
+
+// marker 为沙盒临时目录的归属标记
+type marker struct {
+	ID        string    `json:"id"`
+	Owner     int       `json:"owner"`
+	Purpose   string    `json:"purpose"`
+	PID       int       `json:"pid"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Info 描述一个活动中的沙盒，HardeningReasons 为未能完全加固的原因
+type Info struct {
+	ID               string    `json:"id"`
+	Purpose          string    `json:"purpose"`
+	PID              int       `json:"pid"`
+	CreatedAt        time.Time `json:"created_at"`
+	AgeSec           int64     `json:"age_sec"`
+	DiskUsage        int64     `json:"disk_usage"`
+	Hardening        string    `json:"hardening"`
+	HardeningReasons []string  `json:"hardening_reasons,omitempty"`
+	Isolated         bool      `json:"isolated"`
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      = map[string]*SandboxedProcess{}
+	// retained 为沙盒池持有的根目录，空闲时不会被清理
+	retained = map[string]bool{}
+)
+
+func newSandboxID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func register(p *SandboxedProcess) {
+	registryMutex.Lock()
+	registry[p.id] = p
+	registryMutex.Unlock()
+}
+
+func unregister(id string) {
+	registryMutex.Lock()
+	delete(registry, id)
+	registryMutex.Unlock()
+}
+
+func retain(dir string) {
+	registryMutex.Lock()
+	retained[dir] = true
+	registryMutex.Unlock()
+}
+
+func unretain(dir string) {
+	registryMutex.Lock()
+	delete(retained, dir)
+	registryMutex.Unlock()
+}
+
+func isRetained(dir string) bool {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	return retained[dir]
+}
+
+func lookup(id string) *SandboxedProcess {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	return registry[id]
+}
+
+// writeMarker 写入或更新临时根目录中的归属标记
+func writeMarker(dir string, m marker) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, markerFile), data, 0o600); err != nil {
+		return fmt.Errorf("写入沙盒标记失败: %w", err)
+	}
+	return nil
+}
+
+func readMarker(dir string) (marker, error) {
+	var m marker
+	data, err := os.ReadFile(filepath.Join(dir, markerFile))
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// List 返回当前服务中活动的沙盒
+func List() []Info {
+	registryMutex.Lock()
+	procs := make([]*SandboxedProcess, 0, len(registry))
+	for _, p := range registry {
+		procs = append(procs, p)
+	}
+	registryMutex.Unlock()
+
+	infos := make([]Info, 0, len(procs))
+	for _, p := range procs {
+		info := Info{
+			ID:               p.id,
+			Purpose:          p.purpose,
+			CreatedAt:        p.created,
+			AgeSec:           int64(time.Since(p.created).Seconds()),
+			Hardening:        p.hardening.Level,
+			HardeningReasons: p.hardening.Reasons,
+			Isolated:         p.netns != nil,
+		}
+		if p.cmd.Process != nil {
+			info.PID = p.cmd.Process.Pid
+		}
+		if p.usage != nil {
+			info.DiskUsage, _ = p.usage(info.PID)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].CreatedAt.Before(infos[j].CreatedAt)
+	})
+	return infos
+}
+
+// Kill 立即结束指定的沙盒并清理其临时目录
+func Kill(id string) error {
+	p := lookup(id)
+	if p == nil {
+		return fmt.Errorf("沙盒不存在: %s", id)
+	}
+	return p.Kill()
+}
+
+// SweepStale 清理归属进程已退出的沙盒临时目录与 cgroup，并结束遗留的沙盒进程
+func SweepStale() {
+	dirs, err := filepath.Glob(filepath.Join(os.TempDir(), "sandbox-*"))
+	if err != nil {
+		return
+	}
+
+	for _, dir := range dirs {
+		m, err := readMarker(dir)
+		if err != nil {
+			// 没有标记的目录不属于本服务
+			continue
+		}
+		if m.Owner == os.Getpid() && (lookup(m.ID) != nil || isRetained(dir)) {
+			continue
+		}
+		if m.Owner != os.Getpid() && processAlive(m.Owner) {
+			continue
+		}
+
+		if m.PID > 0 && killOrphan(m.PID, m.ID) {
+			fmt.Printf("已结束遗留的沙盒进程: %d\n", m.PID)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Printf("清理沙盒目录 %s 失败: %v\n", dir, err)
+			continue
+		}
+		fmt.Println("已清理遗留的沙盒目录:", dir)
+	}
+	sweepCgroups()
+}
+
+// StartJanitor 立即执行一次清理，之后按 interval 定期清理
+func StartJanitor(interval time.Duration) {
+	SweepStale()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			SweepStale()
+		}
+	}()
+}
+
+// dirSize 统计目录中普通文件占用的字节数
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size, err
+}
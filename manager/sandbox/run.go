@@ -0,0 +1,97 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// 沙盒中与宿主交换文件的目录名
+const ioDirName = "io"
+
+// Run 在沙盒中运行命令直至退出，ctx 取消或超时时强制结束，
+// 并返回退出情况与 cfg.Outputs 指定的输出文件
+func Run(ctx context.Context, cfg Config) (Result, error) {
+	for _, name := range cfg.Outputs {
+		if err := validFileName(name); err != nil {
+			return Result{}, err
+		}
+	}
+
+	p, err := NewSandboxedProcess(cfg)
+	if err != nil {
+		return Result{}, err
+	}
+	defer p.release()
+
+	if err := p.Start(); err != nil {
+		return Result{}, err
+	}
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			p.timedOut.Store(true)
+		}
+		p.killTree()
+		<-p.done
+	}
+
+	res := p.result
+	res.Files = readOutputs(p.ioDir, cfg.Outputs, cfg.Limits.FileSize)
+	return res, p.waitErr
+}
+
+// validFileName 仅允许 io 目录下的普通文件名，避免路径穿越
+func validFileName(name string) error {
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name || !filepath.IsLocal(name) {
+		return fmt.Errorf("无效的文件名: %s", name)
+	}
+	return nil
+}
+
+func writeInputs(dir string, files map[string][]byte) error {
+	for name, data := range files {
+		if err := validFileName(name); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return fmt.Errorf("写入输入文件失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// readOutputs 读取沙盒写入的输出文件，跳过符号链接等非普通文件
+func readOutputs(dir string, names []string, limit uint64) map[string][]byte {
+	files := map[string][]byte{}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if limit > 0 && uint64(info.Size()) > limit {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		// 打开后再次确认，防止检查后被替换为符号链接
+		if opened, err := f.Stat(); err != nil || !os.SameFile(info, opened) {
+			f.Close()
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(f, info.Size()))
+		f.Close()
+		if err == nil {
+			files[name] = data
+		}
+	}
+	return files
+}
@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -19,100 +21,368 @@ type Config struct {
 	BinaryName string
 	WorkDir    string
 	Args       []string
+	// IsolateNetwork 在独立的网络命名空间中运行，仅 Linux 支持
+	IsolateNetwork bool
+	// Harden 启用 seccomp 与 Landlock 限制，内核不支持时降级
+	Harden bool
+	// Limits 资源与运行时长限制
+	Limits Limits
+	// Purpose 沙盒用途，展示在沙盒列表中
+	Purpose string
+	// Files 启动前写入沙盒 io 目录的输入文件，键为文件名
+	Files map[string][]byte
+	// Outputs 进程退出后从 io 目录读取的输出文件名，仅 Run 使用
+	Outputs []string
+	// Pool 不为空时从沙盒池中取用根目录
+	Pool *Pool
 }
 
+// Hardening 描述沙盒实际生效的加固措施
+type Hardening struct {
+	Level       string   `json:"level"`
+	Seccomp     bool     `json:"seccomp"`
+	Landlock    bool     `json:"landlock"`
+	LandlockABI int      `json:"landlock_abi"`
+	Reasons     []string `json:"reasons"`
+}
+
+const (
+	HardeningNone    = "none"
+	HardeningPartial = "partial"
+	HardeningFull    = "full"
+)
+
+// 进程退出后等待输出管道关闭的最长时间
+const outputWaitDelay = time.Second
+
 type SandboxedProcess struct {
+	id        string
+	purpose   string
+	created   time.Time
+	dir       string
+	usage     func(pid int) (int64, error)
+	ioDir     string
 	cmd       *exec.Cmd
-	stdoutBuf *bytes.Buffer
-	cleanup   func() error
+	tree      *processTree
+	stdoutBuf *OutputBuffer
+	outBuf    *OutputBuffer
+	errBuf    *OutputBuffer
+	netns     *netNamespace
+	hardening Hardening
+	limits    Limits
+	limiter   *resourceLimiter
+	// setup 在启动子进程的线程上依次执行
+	setup       []func() error
+	cleanup     func() error
+	cleanupOnce sync.Once
+	cleanupErr  error
+
+	started  time.Time
+	timer    *time.Timer
+	timedOut atomic.Bool
+	done     chan struct{}
+	result   Result
+	waitErr  error
+}
+
+// sandboxRoot 为沙盒根目录，mount 不为空时需在启动子进程的线程上执行
+type sandboxRoot struct {
+	// dir 为宿主上的临时目录，存放归属标记
+	dir string
+	// ioDir 为宿主上与沙盒交换文件的目录，在沙盒中位于工作目录下的 io
+	ioDir string
+	mount func() error
+	usage func(pid int) (int64, error)
+	// scrub 清除上次运行留下的内容，使根目录可被复用
+	scrub   func() error
+	cleanup func() error
 }
 
 func NewSandboxedProcess(orig Config) (*SandboxedProcess, error) {
-	cfg, cleanup, err := prepareSandbox(orig)
+	cfg, root, err := prepareSandbox(orig)
 	if err != nil {
 		return nil, err
 	}
+	cleanup := root.cleanup
+	id := newSandboxID()
+
+	if err := writeInputs(root.ioDir, orig.Files); err != nil {
+		cleanup()
+		return nil, err
+	}
 
 	cmd := exec.Command(cfg.BinaryPath, cfg.Args...)
 	cmd.Dir = cfg.WorkDir
 	cmd.Stdin = os.Stdin
+	cmd.Env = append(os.Environ(), envMarker+"="+id)
+	// 派生进程持有输出管道时不无限等待，随后整组结束
+	cmd.WaitDelay = outputWaitDelay
 
-	stdoutBuf := new(bytes.Buffer)
-	stdoutWriter := io.MultiWriter(stdoutBuf, os.Stdout)
-	stderrWriter := io.MultiWriter(stdoutBuf, os.Stderr)
-
-	cmd.Stdout = stdoutWriter
-	cmd.Stderr = stderrWriter
+	// 输出仅在内存中有限捕获，不回显到服务的标准输出
+	stdoutBuf := newOutputBuffer(orig.Limits.OutputBytes)
+	outBuf := newOutputBuffer(orig.Limits.OutputBytes)
+	errBuf := newOutputBuffer(orig.Limits.OutputBytes)
+	cmd.Stdout = io.MultiWriter(stdoutBuf, outBuf)
+	cmd.Stderr = io.MultiWriter(stdoutBuf, errBuf)
 
 	if err := applySandboxLimits(cmd); err != nil {
 		cleanup()
 		return nil, err
 	}
 
-	return &SandboxedProcess{
+	limiter := newResourceLimiter(orig.Limits)
+	limiter.prepare(cmd)
+	removeRoot := cleanup
+	cleanup = func() error {
+		limiter.close()
+		return removeRoot()
+	}
+
+	var setup []func() error
+	var netns *netNamespace
+	if orig.IsolateNetwork {
+		if netns, err = newNetNamespace(); err != nil {
+			cleanup()
+			return nil, err
+		}
+		removeDir := cleanup
+		cleanup = func() error {
+			netns.close()
+			return removeDir()
+		}
+		setup = append(setup, netns.enter)
+	}
+	if root.mount != nil {
+		setup = append(setup, root.mount)
+	}
+
+	hardening := Hardening{Level: HardeningNone, Reasons: []string{}}
+	if orig.Harden {
+		var harden func() error
+		harden, hardening = prepareHardening(cfg.WorkDir)
+		if harden != nil {
+			setup = append(setup, harden)
+		}
+	}
+
+	p := &SandboxedProcess{
+		id:        id,
+		purpose:   orig.Purpose,
+		created:   time.Now(),
+		dir:       root.dir,
+		ioDir:     root.ioDir,
+		usage:     root.usage,
 		cmd:       cmd,
 		cleanup:   cleanup,
+		netns:     netns,
+		hardening: hardening,
+		limits:    orig.Limits,
+		limiter:   limiter,
+		setup:     setup,
 		stdoutBuf: stdoutBuf,
-	}, nil
+		outBuf:    outBuf,
+		errBuf:    errBuf,
+		done:      make(chan struct{}),
+	}
+
+	register(p)
+	p.cleanup = func() error {
+		unregister(id)
+		return cleanup()
+	}
+	if err := p.writeMarker(); err != nil {
+		p.release()
+		return nil, err
+	}
+	return p, nil
 }
 
-func (p *SandboxedProcess) Start() error {
-	if runtime.GOOS == "windows" {
-		return startCmdInSandbox(p.cmd)
+func (p *SandboxedProcess) writeMarker() error {
+	m := marker{ID: p.id, Owner: os.Getpid(), Purpose: p.purpose, CreatedAt: p.created}
+	if p.cmd.Process != nil {
+		m.PID = p.cmd.Process.Pid
 	}
-	return p.cmd.Start()
+	return writeMarker(p.dir, m)
 }
 
-func (p *SandboxedProcess) Wait() error {
-	return p.cmd.Wait()
+// ID 返回沙盒的唯一标识
+func (p *SandboxedProcess) ID() string {
+	return p.id
 }
 
-func (p *SandboxedProcess) Stop() error {
-	proc := p.cmd.Process
-	if proc == nil {
-		return fmt.Errorf("没有可停止的进程")
+// release 清理沙盒资源，多次调用只执行一次
+func (p *SandboxedProcess) release() error {
+	p.cleanupOnce.Do(func() {
+		p.cleanupErr = p.cleanup()
+	})
+	return p.cleanupErr
+}
+
+func (p *SandboxedProcess) Start() error {
+	tree, err := startCmdInSandbox(p.cmd, p.setup, p.limiter.attach, p.done)
+	if err != nil {
+		return err
 	}
+	p.tree = tree
+	p.started = time.Now()
+	// 记录进程号，服务异常退出后可据此清理遗留进程
+	p.writeMarker()
 
-	var cleanupOnce sync.Once
-	cleanup := func() error {
-		var err error
-		cleanupOnce.Do(func() {
-			err = p.cleanup()
+	if p.limits.WallClock > 0 {
+		p.timer = time.AfterFunc(p.limits.WallClock, func() {
+			p.timedOut.Store(true)
+			p.killTree()
 		})
-		return err
 	}
 
-	if err := proc.Signal(syscall.SIGTERM); err != nil {
-		return cleanup()
+	go p.wait()
+	return nil
+}
+
+func (p *SandboxedProcess) wait() {
+	err := p.cmd.Wait()
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	// 主进程退出后结束仍存活的派生进程
+	p.tree.kill()
+	p.tree.close()
+	p.result = p.buildResult()
+	if _, ok := err.(*exec.ExitError); !ok {
+		p.waitErr = err
 	}
+	close(p.done)
+}
+
+// buildResult 根据退出状态归类退出原因
+func (p *SandboxedProcess) buildResult() Result {
+	res := Result{
+		Reason:    ExitNormal,
+		ElapsedMs: time.Since(p.started).Milliseconds(),
+		Output:    p.stdoutBuf.String(),
+		Stdout:    p.outBuf.String(),
+		Stderr:    p.errBuf.String(),
+		Truncated: p.stdoutBuf.Truncated() || p.outBuf.Truncated() || p.errBuf.Truncated(),
+	}
+
+	state := p.cmd.ProcessState
+	if state == nil {
+		return res
+	}
+	res.ExitCode = state.ExitCode()
 
-	done := make(chan error, 1)
-	go func() {
-		done <- p.cmd.Wait()
-	}()
+	status, _ := state.Sys().(syscall.WaitStatus)
+	if status.Signaled() {
+		res.Signal = status.Signal().String()
+	}
+
+	limit := p.limiter.exceeded(state, res.Output)
+	switch {
+	case p.timedOut.Load():
+		res.Reason = ExitTimeout
+	case limit != "":
+		res.Reason = ExitLimit
+		res.Limit = limit
+	case status.Signaled():
+		res.Reason = ExitSignal
+	}
+	return res
+}
+
+// Hardening 返回沙盒实际生效的加固措施
+func (p *SandboxedProcess) Hardening() Hardening {
+	return p.hardening
+}
+
+// Forward 返回可从宿主访问沙盒内 127.0.0.1:port 的端口，未隔离网络时原样返回
+func (p *SandboxedProcess) Forward(port int) (int, error) {
+	if p.netns == nil {
+		return port, nil
+	}
+	return p.netns.forward(port)
+}
+
+// Listen 在沙盒中的进程可以访问的回环地址上监听，用于测试沙盒中的进程发起的连接
+func (p *SandboxedProcess) Listen() (net.Listener, error) {
+	if p.netns == nil {
+		return net.Listen("tcp", "127.0.0.1:0")
+	}
+	return p.netns.listen()
+}
+
+// Wait 等待进程退出并返回退出情况
+func (p *SandboxedProcess) Wait() (Result, error) {
+	if p.tree == nil {
+		return Result{}, fmt.Errorf("进程未启动")
+	}
+	<-p.done
+	return p.result, p.waitErr
+}
+
+func (p *SandboxedProcess) Stop() error {
+	if p.tree == nil {
+		return fmt.Errorf("没有可停止的进程")
+	}
+
+	if err := p.tree.signal(syscall.SIGTERM); err != nil {
+		// 不支持信号的平台或进程已退出
+		p.killTree()
+		<-p.done
+		return p.release()
+	}
 
-	var waitErr error
 	select {
 	case <-time.After(5 * time.Second):
 		fmt.Println("进程未能优雅退出，强制杀死")
-		proc.Kill()
-		waitErr = <-done
-	case err := <-done:
-		waitErr = err
+		p.killTree()
+		<-p.done
+	case <-p.done:
 	}
 
-	if waitErr != nil && !strings.Contains(waitErr.Error(), "no child processes") {
-		fmt.Printf("进程退出时出错: %v\n", waitErr)
+	if p.waitErr != nil && !strings.Contains(p.waitErr.Error(), "no child processes") {
+		fmt.Printf("进程退出时出错: %v\n", p.waitErr)
 	}
 
-	return cleanup()
+	return p.release()
 }
 
-func (p *SandboxedProcess) StdoutBuffer() *bytes.Buffer {
+// Kill 立即结束进程并清理沙盒，进程未启动或启动失败时只清理沙盒
+func (p *SandboxedProcess) Kill() error {
+	if p.tree == nil {
+		return p.release()
+	}
+	p.killTree()
+	<-p.done
+	return p.release()
+}
+
+// killTree 强制结束进程及其派生的全部进程
+func (p *SandboxedProcess) killTree() {
+	p.tree.kill()
+	p.cmd.Process.Kill()
+}
+
+func (p *SandboxedProcess) StdoutBuffer() *OutputBuffer {
 	return p.stdoutBuf
 }
 
-func prepareSandbox(orig Config) (Config, func() error, error) {
+func prepareSandbox(orig Config) (Config, *sandboxRoot, error) {
+	if orig.Pool != nil {
+		return orig.Pool.take(orig)
+	}
+	return createSandbox(orig)
+}
+
+func createSandbox(orig Config) (Config, *sandboxRoot, error) {
+	if canBindRoot() {
+		return bindSandbox(orig)
+	}
+	return copySandbox(orig)
+}
+
+// copySandbox 将二进制与工作目录拷贝到临时目录下的 root 中，
+// 归属标记位于 root 之外，沙盒中的进程无法修改
+func copySandbox(orig Config) (Config, *sandboxRoot, error) {
 	tmpRoot, err := os.MkdirTemp("", "sandbox-*")
 	if err != nil {
 		return Config{}, nil, fmt.Errorf("创建临时目录失败: %w", err)
@@ -127,8 +397,15 @@ func prepareSandbox(orig Config) (Config, func() error, error) {
 		return nil
 	}
 
+	rootDir := filepath.Join(tmpRoot, "root")
+	ioDir := filepath.Join(rootDir, ioDirName)
+	if err := os.MkdirAll(ioDir, 0o755); err != nil {
+		cleanup()
+		return Config{}, nil, fmt.Errorf("创建目录失败: %w", err)
+	}
+
 	binName := filepath.Base(orig.BinaryPath)
-	tmpBin := filepath.Join(tmpRoot, binName)
+	tmpBin := filepath.Join(rootDir, binName)
 	if err := copyFile(orig.BinaryPath, tmpBin); err != nil {
 		cleanup()
 		return Config{}, nil, fmt.Errorf("拷贝二进制失败: %w", err)
@@ -139,17 +416,165 @@ func prepareSandbox(orig Config) (Config, func() error, error) {
 		return Config{}, nil, fmt.Errorf("设置执行权限失败: %w", err)
 	}
 
-	if err := copyDir(orig.WorkDir, tmpRoot); err != nil {
+	if err := copyDir(orig.WorkDir, rootDir); err != nil {
 		cleanup()
 		return Config{}, nil, fmt.Errorf("拷贝工作目录失败: %w", err)
 	}
 
+	manifest, err := snapshotDir(rootDir)
+	if err != nil {
+		cleanup()
+		return Config{}, nil, fmt.Errorf("记录沙盒内容失败: %w", err)
+	}
+	sources := func(rel string) string {
+		if rel == binName {
+			return orig.BinaryPath
+		}
+		return filepath.Join(orig.WorkDir, rel)
+	}
+
 	return Config{
 		BinaryPath: tmpBin,
 		BinaryName: binName,
-		WorkDir:    tmpRoot,
+		WorkDir:    rootDir,
 		Args:       orig.Args,
-	}, cleanup, nil
+	}, &sandboxRoot{
+		dir:   tmpRoot,
+		ioDir: ioDir,
+		usage: func(int) (int64, error) {
+			return dirSize(rootDir)
+		},
+		scrub: func() error {
+			return restoreDir(rootDir, manifest, sources)
+		},
+		cleanup: cleanup,
+	}, nil
+}
+
+// fileState 记录拷贝完成时的文件状态，用于复用前还原
+type fileState struct {
+	mode os.FileMode
+	dir  bool
+}
+
+func snapshotDir(root string) (map[string]fileState, error) {
+	manifest := map[string]fileState{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		if rel == "." {
+			return nil
+		}
+		manifest[rel] = fileState{mode: info.Mode().Perm(), dir: info.IsDir()}
+		return nil
+	})
+	return manifest, err
+}
+
+// restoreDir 删除新增的文件，并从源重新拷贝被修改或删除的文件，io 目录被清空。
+// 沙盒中的进程可以同时伪造文件的大小与修改时间，因此逐字节与源文件比较
+func restoreDir(root string, manifest map[string]fileState, source func(rel string) string) error {
+	if err := os.RemoveAll(filepath.Join(root, ioDirName)); err != nil {
+		return err
+	}
+
+	current, err := snapshotDir(root)
+	if err != nil {
+		return err
+	}
+	// 目录被替换为符号链接或文件时，写入会落到宿主的其他位置，不再复用
+	for rel, want := range manifest {
+		if state, ok := current[rel]; ok && want.dir && !state.dir {
+			return fmt.Errorf("沙盒目录 %s 已被替换", rel)
+		}
+	}
+	for rel := range current {
+		if _, ok := manifest[rel]; !ok {
+			if err := os.RemoveAll(filepath.Join(root, rel)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	// 按路径排序使上级目录先于其中的文件还原，上级目录均已确认是真实目录
+	rels := make([]string, 0, len(manifest))
+	for rel := range manifest {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		want := manifest[rel]
+		path := filepath.Join(root, rel)
+		if want.dir {
+			if err := os.Mkdir(path, 0o755); err != nil && !os.IsExist(err) {
+				return err
+			}
+			continue
+		}
+		if same, err := sameContent(path, source(rel)); err != nil {
+			return err
+		} else if same {
+			if err := os.Chmod(path, want.mode); err != nil {
+				return err
+			}
+			continue
+		}
+		os.RemoveAll(path)
+		if err := copyFile(source(rel), path); err != nil {
+			return err
+		}
+		if err := os.Chmod(path, want.mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameContent 判断 path 是否为与 src 内容相同的普通文件
+func sameContent(path, src string) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false, nil
+	}
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	if info.Size() != srcInfo.Size() {
+		return false, nil
+	}
+
+	a, err := os.Open(path)
+	if err != nil {
+		return false, nil
+	}
+	defer a.Close()
+	b, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer b.Close()
+
+	bufA := make([]byte, 64*1024)
+	bufB := make([]byte, 64*1024)
+	for {
+		n, errA := io.ReadFull(a, bufA)
+		m, errB := io.ReadFull(b, bufB)
+		if n != m || !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, nil
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
 }
 
 func copyFile(src, dst string) error {
@@ -2,15 +2,44 @@
 
 package sandbox
 
-import "os/exec"
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+const sandboxExec = "/usr/bin/sandbox-exec"
 
 func applySandboxLimits(cmd *exec.Cmd) error {
 	profile := "(version 1) (allow default)"
-	cmd.Args = append([]string{"sandbox-exec", "-p", profile, "--", cmd.Path}, cmd.Args...)
-	cmd.Path = "sandbox-exec"
+	// cmd.Args[0] 为二进制路径，由 cmd.Path 代替
+	cmd.Args = append([]string{"sandbox-exec", "-p", profile, "--", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = sandboxExec
+	// sandbox-exec 及其派生的进程位于同一进程组，停止时整组结束
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	return nil
 }
 
-func startCmdInSandbox(cmd *exec.Cmd) error {
-	return cmd.Start()
+func startCmdInSandbox(cmd *exec.Cmd, _ []func() error, _ func(pid int) error, _ <-chan struct{}) (*processTree, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return newProcessTree(cmd), nil
+}
+
+func canBindRoot() bool {
+	return false
+}
+
+func bindSandbox(_ Config) (Config, *sandboxRoot, error) {
+	return Config{}, nil, fmt.Errorf("不支持绑定挂载沙盒根目录")
+}
+
+func processAlive(pid int) bool {
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
+
+// killOrphan 无法可靠确认进程归属，不结束进程
+func killOrphan(_ int, _ string) bool {
+	return false
 }
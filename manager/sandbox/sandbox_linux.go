@@ -3,13 +3,39 @@
 package sandbox
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
+// tmpfsHeadroom 为沙盒中新写入文件可用的 tmpfs 空间
+const tmpfsHeadroom = 64 << 20
+
+// 需要在沙盒中只读提供的宿主文件
+var hostFiles = []string{
+	"/etc/resolv.conf",
+	"/etc/hosts",
+	"/etc/nsswitch.conf",
+	"/etc/ssl",
+	"/etc/ca-certificates",
+	"/etc/pki",
+	"/usr/share/ca-certificates",
+}
+
+// 需要在沙盒中提供的设备文件
+var hostDevices = []string{
+	"/dev/null",
+	"/dev/zero",
+	"/dev/random",
+	"/dev/urandom",
+}
+
 func applySandboxLimits(cmd *exec.Cmd) error {
 	uid := os.Getuid()
 	gid := os.Getgid()
@@ -20,11 +46,6 @@ func applySandboxLimits(cmd *exec.Cmd) error {
 	binName := filepath.Base(cmd.Path)
 	cmd.Path = filepath.Join("/", binName)
 
-	hostBinPath := filepath.Join(chrootDir, binName)
-	if err := os.Chmod(hostBinPath, 0755); err != nil {
-		return fmt.Errorf("设置执行权限失败: %w", err)
-	}
-
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Cloneflags: syscall.CLONE_NEWUSER |
 			syscall.CLONE_NEWNS |
@@ -39,11 +60,255 @@ func applySandboxLimits(cmd *exec.Cmd) error {
 		},
 		GidMappingsEnableSetgroups: false,
 		Chroot:                     chrootDir,
+		// 独立进程组便于整组结束，服务退出时子进程随之被杀死
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
 	}
 
 	return nil
 }
 
-func startCmdInSandbox(cmd *exec.Cmd) error {
-	return cmd.Start()
+// startCmdInSandbox 在专用线程上执行 setup 后启动子进程，子进程继承该线程的
+// 命名空间、挂载与安全限制，attach 在同一线程上设置资源限制，失败时结束子进程。
+// Pdeathsig 在创建子进程的线程退出时触发，
+// 因此该线程保持到 exited 关闭，即子进程退出之后
+func startCmdInSandbox(cmd *exec.Cmd, setup []func() error, attach func(pid int) error, exited <-chan struct{}) (*processTree, error) {
+	started := make(chan error, 1)
+	go func() {
+		// 线程状态已被修改，不解锁使其随 goroutine 退出而销毁
+		runtime.LockOSThread()
+
+		for _, fn := range setup {
+			if err := fn(); err != nil {
+				started <- err
+				return
+			}
+		}
+		if err := cmd.Start(); err != nil {
+			started <- err
+			return
+		}
+		// 跟踪子进程的请求只能由启动它的线程发出
+		if err := attach(cmd.Process.Pid); err != nil {
+			newProcessTree(cmd).kill()
+			cmd.Process.Kill()
+			cmd.Wait()
+			started <- err
+			return
+		}
+		started <- nil
+		<-exited
+	}()
+
+	if err := <-started; err != nil {
+		return nil, err
+	}
+	return newProcessTree(cmd), nil
+}
+
+func canBindRoot() bool {
+	return os.Geteuid() == 0
+}
+
+// bindSandbox 构造最小根目录：工作目录通过 overlay 只读挂载，写入落在 tmpfs 中，
+// 二进制与必需的宿主文件只读绑定挂载，真实工作目录不会被修改，
+// 仅宿主上的 io 目录以读写方式挂载到沙盒中用于交换文件
+func bindSandbox(orig Config) (Config, *sandboxRoot, error) {
+	tmpRoot, err := os.MkdirTemp("", "sandbox-*")
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+
+	binPath, err := filepath.Abs(orig.BinaryPath)
+	if err != nil {
+		os.RemoveAll(tmpRoot)
+		return Config{}, nil, fmt.Errorf("解析二进制路径失败: %w", err)
+	}
+	workDir, err := filepath.Abs(orig.WorkDir)
+	if err != nil {
+		os.RemoveAll(tmpRoot)
+		return Config{}, nil, fmt.Errorf("解析工作目录失败: %w", err)
+	}
+
+	binName := filepath.Base(binPath)
+	rootDir := filepath.Join(tmpRoot, "root")
+	scratchDir := filepath.Join(tmpRoot, "tmp")
+	ioDir := filepath.Join(tmpRoot, ioDirName)
+	for _, dir := range []string{rootDir, scratchDir, ioDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			os.RemoveAll(tmpRoot)
+			return Config{}, nil, fmt.Errorf("创建目录失败: %w", err)
+		}
+	}
+
+	mount := func() error {
+		if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+			return fmt.Errorf("创建挂载命名空间失败: %w", err)
+		}
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+			return fmt.Errorf("设置挂载传播失败: %w", err)
+		}
+		opts := tmpfsOptions(workDir)
+		if err := mountTmpfs(scratchDir, opts); err != nil {
+			return err
+		}
+		if err := mountWorkDir(scratchDir, rootDir, workDir, opts); err != nil {
+			return err
+		}
+		if err := bindReadOnly(binPath, filepath.Join(rootDir, binName)); err != nil {
+			return fmt.Errorf("挂载二进制失败: %w", err)
+		}
+		for _, path := range hostFiles {
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			if err := bindReadOnly(path, filepath.Join(rootDir, path)); err != nil {
+				return fmt.Errorf("挂载 %s 失败: %w", path, err)
+			}
+		}
+		for _, path := range hostDevices {
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			if err := bindMount(path, filepath.Join(rootDir, path), 0); err != nil {
+				return fmt.Errorf("挂载 %s 失败: %w", path, err)
+			}
+		}
+		if err := bindMount(ioDir, filepath.Join(rootDir, ioDirName), unix.MS_NODEV); err != nil {
+			return fmt.Errorf("挂载 io 目录失败: %w", err)
+		}
+		return nil
+	}
+
+	cleanup := func() error {
+		if err := os.RemoveAll(tmpRoot); err != nil {
+			return fmt.Errorf("删除 %s 失败: %w", tmpRoot, err)
+		}
+		return nil
+	}
+
+	// 挂载只存在于子进程的命名空间中，复用时只需清空 io 目录
+	scrub := func() error {
+		if err := os.RemoveAll(ioDir); err != nil {
+			return err
+		}
+		return os.Mkdir(ioDir, 0o755)
+	}
+
+	return Config{
+		BinaryPath: filepath.Join(rootDir, binName),
+		BinaryName: binName,
+		WorkDir:    rootDir,
+		Args:       orig.Args,
+	}, &sandboxRoot{dir: tmpRoot, ioDir: ioDir, mount: mount, usage: tmpfsUsage, scrub: scrub, cleanup: cleanup}, nil
+}
+
+// tmpfsUsage 统计沙盒根目录所在 tmpfs 的占用，overlay 返回上层目录所在文件系统的数据
+func tmpfsUsage(pid int) (int64, error) {
+	if pid <= 0 {
+		return 0, nil
+	}
+	var stat unix.Statfs_t
+	if err := unix.Statfs(fmt.Sprintf("/proc/%d/root", pid), &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Blocks-stat.Bfree) * int64(stat.Bsize), nil
+}
+
+// processAlive 报告进程是否仍在运行
+func processAlive(pid int) bool {
+	return unix.Kill(pid, 0) != unix.ESRCH
+}
+
+// killOrphan 确认进程环境变量中带有沙盒标记后将其结束
+func killOrphan(pid int, id string) bool {
+	environ, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return false
+	}
+	if !bytes.Contains(environ, []byte(envMarker+"="+id+"\x00")) {
+		return false
+	}
+	return unix.Kill(pid, unix.SIGKILL) == nil
+}
+
+// tmpfsOptions 按工作目录中普通文件的总大小设置 tmpfs 容量，
+// overlay 写入已有文件前会将整个文件复制到上层，例如较大的 cache.db
+func tmpfsOptions(workDir string) string {
+	size, _ := dirSize(workDir)
+	return fmt.Sprintf("size=%d,mode=0755", size+tmpfsHeadroom)
+}
+
+func mountTmpfs(dir, opts string) error {
+	if err := unix.Mount("tmpfs", dir, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, opts); err != nil {
+		return fmt.Errorf("挂载 tmpfs 失败: %w", err)
+	}
+	return nil
+}
+
+// mountWorkDir 优先使用 overlay，内核不支持时在 tmpfs 上逐项只读绑定工作目录内容
+func mountWorkDir(scratchDir, rootDir, workDir, tmpfsOpts string) error {
+	upper := filepath.Join(scratchDir, "upper")
+	work := filepath.Join(scratchDir, "work")
+	for _, dir := range []string{upper, work} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("创建目录失败: %w", err)
+		}
+	}
+
+	opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", workDir, upper, work)
+	if err := unix.Mount("overlay", rootDir, "overlay", unix.MS_NOSUID|unix.MS_NODEV, opts); err == nil {
+		return nil
+	}
+
+	if err := mountTmpfs(rootDir, tmpfsOpts); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		return fmt.Errorf("读取工作目录失败: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if err := bindReadOnly(filepath.Join(workDir, name), filepath.Join(rootDir, name)); err != nil {
+			return fmt.Errorf("挂载 %s 失败: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func bindReadOnly(src, dst string) error {
+	return bindMount(src, dst, unix.MS_RDONLY)
+}
+
+// bindMount 绑定挂载 src 到 dst，按需创建挂载点
+func bindMount(src, dst string, flags uintptr) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if err := os.MkdirAll(dst, 0o755); err != nil {
+			return err
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		if _, err := os.Lstat(dst); os.IsNotExist(err) {
+			f, err := os.OpenFile(dst, os.O_CREATE|os.O_RDONLY, 0o644)
+			if err != nil {
+				return err
+			}
+			f.Close()
+		}
+	}
+
+	if err := unix.Mount(src, dst, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return err
+	}
+	if flags == 0 {
+		return nil
+	}
+	return unix.Mount("", dst, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_NOSUID|flags, "")
 }
@@ -0,0 +1,28 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 写入工作目录中较大的文件时 overlay 复制到上层不会耗尽 tmpfs
+func TestOverlayCopyUpLargeFile(t *testing.T) {
+	cfg := helperConfig(t, "append", "cache.db")
+	if err := os.WriteFile(filepath.Join(cfg.WorkDir, "cache.db"), bytes.Repeat([]byte{1}, 96<<20), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.ExitCode != 0 {
+		t.Errorf("Result = %+v, stdout = %q", res, res.Stdout)
+	}
+	if info, err := os.Stat(filepath.Join(cfg.WorkDir, "cache.db")); err != nil || info.Size() != 96<<20 {
+		t.Errorf("工作目录中的文件被修改: %v", err)
+	}
+}
@@ -6,12 +6,43 @@ import (
 	"fmt"
 	"os/exec"
 	"runtime"
+	"syscall"
 )
 
 func applySandboxLimits(_ *exec.Cmd) error {
 	return fmt.Errorf("不支持的操作系统: %s", runtime.GOOS)
 }
 
-func startCmdInSandbox(_ *exec.Cmd) error {
+type processTree struct{}
+
+func startCmdInSandbox(_ *exec.Cmd, _ []func() error, _ func(pid int) error, _ <-chan struct{}) (*processTree, error) {
+	return nil, fmt.Errorf("不支持的操作系统: %s", runtime.GOOS)
+}
+
+func (t *processTree) signal(_ syscall.Signal) error {
 	return fmt.Errorf("不支持的操作系统: %s", runtime.GOOS)
 }
+
+func (t *processTree) kill() error {
+	return nil
+}
+
+func (t *processTree) close() error {
+	return nil
+}
+
+func canBindRoot() bool {
+	return false
+}
+
+func bindSandbox(_ Config) (Config, *sandboxRoot, error) {
+	return Config{}, nil, fmt.Errorf("不支持的操作系统: %s", runtime.GOOS)
+}
+
+func processAlive(_ int) bool {
+	return false
+}
+
+func killOrphan(_ int, _ string) bool {
+	return false
+}
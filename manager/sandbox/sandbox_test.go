@@ -0,0 +1,124 @@
+package sandbox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopySandboxMarkerOutsideRoot(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "core")
+	if err := os.WriteFile(bin, []byte("binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg, root, err := copySandbox(Config{BinaryPath: bin, WorkDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("copySandbox() error = %v", err)
+	}
+	defer root.cleanup()
+
+	writeMarker(root.dir, marker{Owner: os.Getpid(), Purpose: "test", CreatedAt: time.Now()})
+	if _, err := os.Stat(filepath.Join(root.dir, markerFile)); err != nil {
+		t.Fatalf("归属标记未写入: %v", err)
+	}
+	rel, err := filepath.Rel(cfg.WorkDir, filepath.Join(root.dir, markerFile))
+	if err != nil || !strings.HasPrefix(rel, "..") {
+		t.Errorf("归属标记 %s 位于沙盒根目录 %s 中", filepath.Join(root.dir, markerFile), cfg.WorkDir)
+	}
+	if err := root.scrub(); err != nil {
+		t.Errorf("scrub() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root.dir, markerFile)); err != nil {
+		t.Errorf("scrub() 删除了归属标记: %v", err)
+	}
+}
+
+func TestRestoreDirComparesSource(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "core")
+	if err := os.WriteFile(bin, []byte("binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	workDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workDir, "config.yaml"), []byte("port: 7890"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, root, err := copySandbox(Config{BinaryPath: bin, WorkDir: workDir})
+	if err != nil {
+		t.Fatalf("copySandbox() error = %v", err)
+	}
+	defer root.cleanup()
+
+	// 保持大小与修改时间不变地篡改文件
+	for _, path := range []string{cfg.BinaryPath, filepath.Join(cfg.WorkDir, "config.yaml")} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, bytes.Repeat([]byte("x"), int(info.Size())), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := root.scrub(); err != nil {
+		t.Fatalf("scrub() error = %v", err)
+	}
+
+	for path, want := range map[string]string{
+		cfg.BinaryPath: "binary",
+		filepath.Join(cfg.WorkDir, "config.yaml"): "port: 7890",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != want {
+			t.Errorf("还原后 %s = %q, want %q", filepath.Base(path), data, want)
+		}
+	}
+}
+
+func TestRestoreDirRejectsSymlinkedDir(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "core")
+	if err := os.WriteFile(bin, []byte("binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	workDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(workDir, "ruleset"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "ruleset", "rules.yaml"), []byte("payload: []"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, root, err := copySandbox(Config{BinaryPath: bin, WorkDir: workDir})
+	if err != nil {
+		t.Fatalf("copySandbox() error = %v", err)
+	}
+	defer root.cleanup()
+
+	// 沙盒中的进程将目录替换为指向宿主目录的符号链接
+	host := t.TempDir()
+	hostFile := filepath.Join(host, "rules.yaml")
+	if err := os.WriteFile(hostFile, []byte("host"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(cfg.WorkDir, "ruleset")
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(host, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := root.scrub(); err == nil {
+		t.Error("scrub() 未拒绝被替换为符号链接的目录")
+	}
+	data, err := os.ReadFile(hostFile)
+	if err != nil || string(data) != "host" {
+		t.Errorf("宿主文件被修改: %q, %v", data, err)
+	}
+	if info, err := os.Stat(hostFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("宿主文件权限被修改: %v", err)
+	}
+}
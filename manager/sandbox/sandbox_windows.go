@@ -5,6 +5,8 @@ package sandbox
 import (
 	"fmt"
 	"os/exec"
+	"sync"
+	"syscall"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
@@ -14,15 +16,24 @@ func applySandboxLimits(_ *exec.Cmd) error {
 	return nil
 }
 
-func startCmdInSandbox(cmd *exec.Cmd) error {
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("启动失败: %w", err)
-	}
+func canBindRoot() bool {
+	return false
+}
 
+func bindSandbox(_ Config) (Config, *sandboxRoot, error) {
+	return Config{}, nil, fmt.Errorf("不支持绑定挂载沙盒根目录")
+}
+
+// processTree 为包含子进程及其派生进程的作业对象，句柄关闭时整体结束
+type processTree struct {
+	mutex sync.Mutex
+	job   windows.Handle
+}
+
+func startCmdInSandbox(cmd *exec.Cmd, _ []func() error, _ func(pid int) error, _ <-chan struct{}) (*processTree, error) {
 	job, err := windows.CreateJobObject(nil, nil)
 	if err != nil {
-		cmd.Process.Kill()
-		return err
+		return nil, err
 	}
 
 	info := windows.JOBOBJECT_BASIC_LIMIT_INFORMATION{
@@ -35,10 +46,118 @@ func startCmdInSandbox(cmd *exec.Cmd) error {
 		uintptr(unsafe.Pointer(&info)),
 		uint32(unsafe.Sizeof(info)),
 	)
+	if err != nil {
+		windows.CloseHandle(job)
+		return nil, err
+	}
+
+	// 以挂起状态创建进程，加入作业对象后再恢复运行，
+	// 否则进程在加入之前派生的子进程不受作业对象管理
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= windows.CREATE_SUSPENDED
+
+	if err := cmd.Start(); err != nil {
+		windows.CloseHandle(job)
+		return nil, fmt.Errorf("启动失败: %w", err)
+	}
+
+	proc, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmd.Process.Pid))
+	if err == nil {
+		err = windows.AssignProcessToJobObject(job, proc)
+		windows.CloseHandle(proc)
+	}
 	if err != nil {
 		cmd.Process.Kill()
+		cmd.Wait()
+		windows.CloseHandle(job)
+		return nil, fmt.Errorf("加入作业对象失败: %w", err)
+	}
+
+	if err := resumeProcess(uint32(cmd.Process.Pid)); err != nil {
+		windows.TerminateJobObject(job, 1)
+		cmd.Wait()
+		windows.CloseHandle(job)
+		return nil, fmt.Errorf("恢复进程失败: %w", err)
+	}
+	return &processTree{job: job}, nil
+}
+
+// resumeProcess 恢复挂起创建的进程，exec 不保留主线程句柄，需要从线程快照中查找
+func resumeProcess(pid uint32) error {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPTHREAD, 0)
+	if err != nil {
 		return err
 	}
+	defer windows.CloseHandle(snapshot)
+
+	entry := windows.ThreadEntry32{Size: uint32(unsafe.Sizeof(windows.ThreadEntry32{}))}
+	resumed := false
+	for err = windows.Thread32First(snapshot, &entry); err == nil; err = windows.Thread32Next(snapshot, &entry) {
+		if entry.OwnerProcessID != pid {
+			continue
+		}
+		thread, err := windows.OpenThread(windows.THREAD_SUSPEND_RESUME, false, entry.ThreadID)
+		if err != nil {
+			return err
+		}
+		_, err = windows.ResumeThread(thread)
+		windows.CloseHandle(thread)
+		if err != nil {
+			return err
+		}
+		resumed = true
+	}
+	if !resumed {
+		return fmt.Errorf("未找到进程 %d 的线程", pid)
+	}
+	return nil
+}
+
+// signal Windows 不支持向进程发送信号
+func (t *processTree) signal(_ syscall.Signal) error {
+	return fmt.Errorf("不支持发送信号")
+}
+
+func (t *processTree) kill() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.job == 0 {
+		return nil
+	}
+	return windows.TerminateJobObject(t.job, 1)
+}
+
+func (t *processTree) close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.job == 0 {
+		return nil
+	}
+	err := windows.CloseHandle(t.job)
+	t.job = 0
+	return err
+}
+
+// GetExitCodeProcess 对运行中的进程返回 STILL_ACTIVE
+const stillActive = 259
+
+func processAlive(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(h)
+
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
 
-	return windows.AssignProcessToJobObject(job, windows.Handle(cmd.Process.Pid))
+// killOrphan 沙盒进程随作业对象句柄关闭而结束，无需额外处理
+func killOrphan(_ int, _ string) bool {
+	return false
 }
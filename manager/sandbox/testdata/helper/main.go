@@ -0,0 +1,90 @@
+// helper 为沙盒测试在沙盒中运行的程序，第一个参数指定行为
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "rlimits":
+		// 输出进程开始运行时已生效的资源限制
+		var cpu, fsize syscall.Rlimit
+		syscall.Getrlimit(syscall.RLIMIT_CPU, &cpu)
+		syscall.Getrlimit(syscall.RLIMIT_FSIZE, &fsize)
+		fmt.Printf("cpu=%d fsize=%d\n", cpu.Cur, fsize.Cur)
+	case "write":
+		n, _ := strconv.Atoi(os.Args[2])
+		if err := os.WriteFile("io/out", make([]byte, n), 0o644); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case "append":
+		// 以写方式打开工作目录中的文件，overlay 会将整个文件复制到上层
+		f, err := os.OpenFile(os.Args[2], os.O_WRONLY|os.O_APPEND, 0)
+		if err == nil {
+			_, err = f.Write([]byte{0})
+			f.Close()
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case "sleep":
+		time.Sleep(time.Minute)
+	case "tree":
+		// 派生子进程，子进程再派生脱离进程组的孙进程，全部就绪后输出 ready
+		spawn("branch")
+		fmt.Println("ready")
+		if len(os.Args) > 2 && os.Args[2] == "exit" {
+			return
+		}
+		time.Sleep(time.Minute)
+	case "branch":
+		spawn("leaf")
+		fmt.Println("ready")
+		time.Sleep(time.Minute)
+	case "leaf":
+		fmt.Println("ready")
+		time.Sleep(time.Minute)
+	default:
+		os.Exit(2)
+	}
+}
+
+// spawn 以 mode 启动自身并等待其输出 ready
+func spawn(mode string) {
+	exe, err := os.Executable()
+	if err != nil {
+		// 沙盒根目录中没有 /proc，二进制位于根目录下
+		exe = "/" + filepath.Base(os.Args[0])
+	}
+	cmd := exec.Command(exe, mode)
+	cmd.Stderr = os.Stderr
+	if mode == "leaf" {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := cmd.Start(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if line, _ := bufio.NewReader(out).ReadString('\n'); line != "ready\n" {
+		fmt.Println("子进程未就绪")
+		os.Exit(1)
+	}
+}
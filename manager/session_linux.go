@@ -0,0 +1,232 @@
+//go:build linux
+
+package manager
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/godbus/dbus/v5"
+	"golang.org/x/sys/unix"
+)
+
+const userRuntimeRoot = "/run/user"
+
+// Session 为一个已登录用户的会话，用于以该用户身份修改其代理设置
+type Session struct {
+	uid        uint32
+	gid        uint32
+	groups     []uint32
+	user       string
+	homeDir    string
+	runtimeDir string
+	dbusAddr   string
+}
+
+var (
+	sessionMutex sync.Mutex
+	sessions     = map[uint32]*Session{}
+)
+
+// getSession 返回 uid 对应的会话，用户没有运行时目录时视为未登录
+func getSession(uid uint32) (*Session, error) {
+	runtimeDir := fmt.Sprintf("%s/%d", userRuntimeRoot, uid)
+
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	if _, err := os.Stat(runtimeDir); err != nil {
+		delete(sessions, uid)
+		return nil, fmt.Errorf("用户 %d 没有活动的会话：%v", uid, err)
+	}
+	if s, ok := sessions[uid]; ok {
+		return s, nil
+	}
+
+	u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup user: %v", err)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("无效的用户组 %s：%v", u.Gid, err)
+	}
+	s := &Session{
+		uid:        uid,
+		gid:        uint32(gid),
+		user:       u.Username,
+		homeDir:    u.HomeDir,
+		runtimeDir: runtimeDir,
+		dbusAddr:   fmt.Sprintf("unix:path=%s/bus", runtimeDir),
+	}
+	if ids, err := u.GroupIds(); err == nil {
+		for _, id := range ids {
+			if group, err := strconv.ParseUint(id, 10, 32); err == nil {
+				s.groups = append(s.groups, uint32(group))
+			}
+		}
+	}
+	sessions[uid] = s
+	return s, nil
+}
+
+// command 以会话用户的身份和环境运行命令
+func (s *Session) command(name string, arg ...string) *exec.Cmd {
+	cmd := exec.Command(name, arg...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid:    s.uid,
+			Gid:    s.gid,
+			Groups: s.groups,
+		},
+	}
+	cmd.Env = append(cmd.Env,
+		fmt.Sprintf("DBUS_SESSION_BUS_ADDRESS=%s", s.dbusAddr),
+		fmt.Sprintf("XDG_RUNTIME_DIR=%s", s.runtimeDir),
+		fmt.Sprintf("XDG_CONFIG_HOME=%s/.config", s.homeDir),
+	)
+	return cmd
+}
+
+// connectBus 以会话用户的身份连接其会话总线。会话总线只接受所属用户的连接，
+// 而连接的身份取自建立连接时线程的凭据，因此在单独锁定的线程上临时切换凭据后连接
+func (s *Session) connectBus() (*dbus.Conn, error) {
+	auth := dbus.WithAuth(dbus.AuthExternal(strconv.FormatUint(uint64(s.uid), 10)))
+	if os.Geteuid() != 0 || s.uid == 0 {
+		return dbus.Connect(s.dbusAddr, auth)
+	}
+
+	var conn *dbus.Conn
+	err := s.asUser(func() error {
+		var err error
+		conn, err = dbus.Connect(s.dbusAddr, auth)
+		return err
+	})
+	return conn, err
+}
+
+// asUser 在锁定的线程上以会话用户的凭据运行 fn，只影响该线程
+func (s *Session) asUser(fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		// 凭据未能恢复时不解除锁定，线程随 goroutine 退出而销毁
+		runtime.LockOSThread()
+		if err := setThreadCreds(s.uid, s.gid, 0); err != nil {
+			done <- fmt.Errorf("无法切换到用户 %d：%v", s.uid, err)
+			return
+		}
+		err := fn()
+		if setThreadCreds(0, 0, 0) == nil {
+			runtime.UnlockOSThread()
+		}
+		done <- err
+	}()
+	return <-done
+}
+
+// setThreadCreds 设置当前线程的实际与有效 uid、gid，保存的 uid 与 gid 为 saved 以便恢复。
+// syscall.Setresuid 会同步到所有线程，因此直接发起系统调用
+func setThreadCreds(uid, gid, saved uint32) error {
+	ids := [][3]uintptr{
+		{unix.SYS_SETRESGID, uintptr(gid), uintptr(saved)},
+		{unix.SYS_SETRESUID, uintptr(uid), uintptr(saved)},
+	}
+	// 切回 root 时需先恢复 uid 才有权限修改 gid
+	if uid == 0 {
+		ids[0], ids[1] = ids[1], ids[0]
+	}
+	for _, id := range ids {
+		if _, _, errno := unix.RawSyscall(id[0], id[1], id[1], id[2]); errno != 0 {
+			return errno
+		}
+	}
+	return nil
+}
+
+// ListUserSessions 列出已登录的用户，合并 logind 与 /run/user 中的信息
+func ListUserSessions() ([]SessionInfo, error) {
+	users := map[uint32]*SessionInfo{}
+	lookup := func(uid uint32) *SessionInfo {
+		if info, ok := users[uid]; ok {
+			return info
+		}
+		info := &SessionInfo{UID: uid, Sessions: []string{}}
+		if u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10)); err == nil {
+			info.User, info.Home = u.Username, u.HomeDir
+		}
+		users[uid] = info
+		return info
+	}
+
+	entries, err := os.ReadDir(userRuntimeRoot)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("无法读取 %s：%v", userRuntimeRoot, err)
+	}
+	for _, entry := range entries {
+		uid, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		lookup(uint32(uid)).RuntimeDir = fmt.Sprintf("%s/%d", userRuntimeRoot, uid)
+	}
+
+	// logind 不可用时只使用运行时目录
+	_ = listLogindSessions(lookup)
+
+	list := make([]SessionInfo, 0, len(users))
+	for _, info := range users {
+		list = append(list, *info)
+	}
+	slices.SortFunc(list, func(a, b SessionInfo) int {
+		return int(a.UID) - int(b.UID)
+	})
+	return list, nil
+}
+
+func listLogindSessions(lookup func(uint32) *SessionInfo) error {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	manager := conn.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+	var users []struct {
+		UID  uint32
+		Name string
+		Path dbus.ObjectPath
+	}
+	if err := manager.Call("org.freedesktop.login1.Manager.ListUsers", 0).Store(&users); err != nil {
+		return err
+	}
+	for _, u := range users {
+		info := lookup(u.UID)
+		info.User = u.Name
+		if state, err := conn.Object("org.freedesktop.login1", u.Path).GetProperty("org.freedesktop.login1.User.State"); err == nil {
+			info.State, _ = state.Value().(string)
+		}
+	}
+
+	var list []struct {
+		ID   string
+		UID  uint32
+		User string
+		Seat string
+		Path dbus.ObjectPath
+	}
+	if err := manager.Call("org.freedesktop.login1.Manager.ListSessions", 0).Store(&list); err != nil {
+		return err
+	}
+	for _, session := range list {
+		info := lookup(session.UID)
+		info.Sessions = append(info.Sessions, session.ID)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// asUser 只切换执行 fn 的线程，连接的对端凭据为会话用户
+func TestSessionAsUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("需要 root 权限")
+	}
+	// 会话用户需要能进入套接字所在的目录
+	dir, err := os.MkdirTemp("", "sparkle-bus-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "bus")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := os.Chmod(path, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Session{uid: 65534, gid: 65534}
+	var uid, gid int
+	if err := s.asUser(func() error {
+		uid, gid = unix.Getuid(), unix.Getgid()
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}); err != nil {
+		t.Fatalf("asUser() error = %v", err)
+	}
+	if uid != 65534 || gid != 65534 {
+		t.Errorf("asUser() 线程凭据 = %d:%d, want 65534:65534", uid, gid)
+	}
+	if os.Geteuid() != 0 || os.Getegid() != 0 {
+		t.Errorf("asUser() 改变了其他线程的凭据：%d:%d", os.Geteuid(), os.Getegid())
+	}
+
+	conn, err := l.AcceptUnix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cred *unix.Ucred
+	raw.Control(func(fd uintptr) {
+		cred, err = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Uid != 65534 || cred.Gid != 65534 {
+		t.Errorf("对端凭据 = %d:%d, want 65534:65534", cred.Uid, cred.Gid)
+	}
+}
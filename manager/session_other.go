@@ -0,0 +1,10 @@
+//go:build !linux
+
+package manager
+
+import "fmt"
+
+// ListUserSessions 其他平台的代理设置不区分用户会话
+func ListUserSessions() ([]SessionInfo, error) {
+	return nil, fmt.Errorf("不支持的操作系统")
+}
@@ -1,7 +1,12 @@
 package manager
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
+	"net"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -18,6 +23,244 @@ type ProxyConfig struct {
 	} `json:"pac"`
 }
 
+// ProxyServers 为各协议的代理地址，Server 用于未单独指定的协议
+type ProxyServers struct {
+	Server     string
+	HTTP       string
+	HTTPS      string
+	SOCKS      string
+	FTP        string
+	SameForAll *bool
+}
+
+// SetProxy 设置系统代理，首次修改前保存用户原有设置，并写入启用的命令行代理目标
+func SetProxy(servers ProxyServers, bypass, desktop string, uid uint32) error {
+	backends, err := proxyBackends(desktop, uid)
+	if err != nil {
+		return err
+	}
+	config, err := buildProxyConfig(servers, bypass, func() (*ProxyConfig, error) {
+		return QueryProxySettings(backends[0], uid)
+	})
+	if err != nil {
+		return err
+	}
+	// 写入前检查所有后端，避免部分后端已修改
+	if err := validateBypass(splitBypass(config.Proxy.Bypass), backends); err != nil {
+		return err
+	}
+	if err := snapshotBeforeChange(backends, uid); err != nil {
+		return err
+	}
+	applied, err := applyBackends(backends, uid, func(backend string) error {
+		return setSystemProxy(config, backend, uid)
+	})
+	if len(applied) == 0 {
+		return err
+	}
+	return errors.Join(err, applyProxyTargets(uid, config))
+}
+
+// SetPac 设置 PAC 地址，首次修改前保存用户原有设置
+func SetPac(pacUrl, desktop string, uid uint32) error {
+	backends, err := proxyBackends(desktop, uid)
+	if err != nil {
+		return err
+	}
+	if err := snapshotBeforeChange(backends, uid); err != nil {
+		return err
+	}
+	// 命令行工具不支持 PAC，移除之前写入的代理
+	if err := applyProxyTargets(uid, nil); err != nil {
+		return err
+	}
+	_, err = applyBackends(backends, uid, func(backend string) error {
+		return setSystemPac(pacUrl, backend, uid)
+	})
+	return err
+}
+
+// applyBackends 依次修改各后端，某个后端失败时继续修改其余后端，
+// 并守护修改成功的后端，返回修改成功的后端与各后端的错误
+func applyBackends(backends []string, uid uint32, apply func(backend string) error) ([]string, error) {
+	// 停止守护，避免守护将修改视为偏离而覆盖
+	guard := proxyGuard(uid)
+	guard.untrack()
+
+	var (
+		applied []string
+		errs    []error
+	)
+	for _, backend := range backends {
+		if err := apply(backend); err != nil {
+			errs = append(errs, fmt.Errorf("%s：%w", backend, err))
+			continue
+		}
+		applied = append(applied, backend)
+	}
+	if len(applied) > 0 {
+		guard.track(applied)
+	}
+	return applied, errors.Join(errs...)
+}
+
+// DisableProxy 关闭系统代理，启用 restore-on-disable 时恢复原有设置
+func DisableProxy(desktop string, uid uint32) error {
+	backends, err := proxyBackends(desktop, uid)
+	if err != nil {
+		return err
+	}
+	proxyGuard(uid).untrack()
+	errs := []error{applyProxyTargets(uid, nil)}
+	for _, backend := range backends {
+		if restored, err := restoreOnDisable(backend, uid); restored || err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, disableSystemProxy(backend, uid))
+	}
+	return errors.Join(errs...)
+}
+
+// proxyBackends 解析以逗号分隔的多个桌面，例如同时设置桌面与 NetworkManager，
+// 第一个后端用于读取当前设置
+func proxyBackends(desktop string, uid uint32) ([]string, error) {
+	var backends []string
+	for _, item := range strings.Split(desktop, ",") {
+		backend, err := proxyBackend(strings.TrimSpace(item), uid)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(backends, backend) {
+			backends = append(backends, backend)
+		}
+	}
+	return backends, nil
+}
+
+// buildProxyConfig 按 SameForAll 语义展开各协议地址并在写入前校验，
+// 未指定服务器或例外列表时沿用当前设置
+func buildProxyConfig(servers ProxyServers, bypass string, current func() (*ProxyConfig, error)) (*ProxyConfig, error) {
+	perProtocol := map[string]string{
+		"http_server":  servers.HTTP,
+		"https_server": servers.HTTPS,
+		"socks_server": servers.SOCKS,
+		"ftp_server":   servers.FTP,
+	}
+	explicit := false
+	for _, server := range perProtocol {
+		explicit = explicit || server != ""
+	}
+	sameForAll := !explicit
+	if servers.SameForAll != nil {
+		sameForAll = *servers.SameForAll
+	}
+
+	config := &ProxyConfig{}
+	config.Proxy.Enable = true
+	config.Proxy.SameForAll = sameForAll
+	config.Proxy.Servers = map[string]string{}
+	if bypass != "" {
+		list, err := ParseBypass(bypass)
+		if err != nil {
+			return nil, err
+		}
+		config.Proxy.Bypass = list.String()
+	}
+	for key, server := range perProtocol {
+		if sameForAll {
+			config.Proxy.Servers[key] = cmp.Or(servers.Server, servers.HTTP)
+		} else {
+			config.Proxy.Servers[key] = cmp.Or(server, servers.Server)
+		}
+	}
+
+	empty := true
+	for _, server := range config.Proxy.Servers {
+		empty = empty && server == ""
+	}
+	if empty || bypass == "" {
+		existing, err := current()
+		if err != nil {
+			return nil, err
+		}
+		if empty {
+			for key := range perProtocol {
+				if sameForAll {
+					config.Proxy.Servers[key] = existing.Proxy.Servers["http_server"]
+				} else {
+					config.Proxy.Servers[key] = existing.Proxy.Servers[key]
+				}
+			}
+		}
+		if bypass == "" {
+			config.Proxy.Bypass = existing.Proxy.Bypass
+		}
+	}
+
+	empty = true
+	for _, server := range config.Proxy.Servers {
+		if server == "" {
+			continue
+		}
+		empty = false
+		if err := validateServer(server); err != nil {
+			return nil, err
+		}
+	}
+	if empty {
+		return nil, fmt.Errorf("未指定代理服务器")
+	}
+	return config, nil
+}
+
+// validateServer 校验 host:port 格式的代理地址，IPv6 地址需要使用方括号
+func validateServer(server string) error {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		return fmt.Errorf("无效的代理地址 %s：%v", server, err)
+	}
+	if host == "" || strings.ContainsAny(host, " /[]") {
+		return fmt.Errorf("无效的代理地址 %s：主机名无效", server)
+	}
+	if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+		return fmt.Errorf("无效的代理地址 %s：IPv6 地址无效", server)
+	}
+	if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+		return fmt.Errorf("无效的代理地址 %s：端口无效", server)
+	}
+	return nil
+}
+
+// SessionInfo 为一个已登录用户，State 与 Sessions 来自 logind
+type SessionInfo struct {
+	UID        uint32   `json:"uid"`
+	User       string   `json:"user"`
+	Home       string   `json:"home,omitempty"`
+	RuntimeDir string   `json:"runtime_dir,omitempty"`
+	State      string   `json:"state,omitempty"`
+	Sessions   []string `json:"sessions"`
+}
+
+// TargetStatus 为命令行代理目标的状态，Service 为需要重启才能生效的守护进程
+type TargetStatus struct {
+	Name            string `json:"name"`
+	Enabled         bool   `json:"enabled"`
+	Service         string `json:"service,omitempty"`
+	RestartRequired bool   `json:"restart_required"`
+}
+
+// DesktopInfo 为桌面环境的检测结果
+type DesktopInfo struct {
+	Desktop        string   `json:"desktop"`
+	Source         string   `json:"source"`
+	PID            int      `json:"pid,omitempty"`
+	CurrentDesktop string   `json:"xdg_current_desktop,omitempty"`
+	SessionVersion string   `json:"kde_session_version,omitempty"`
+	Session        string   `json:"desktop_session,omitempty"`
+	Tools          []string `json:"tools"`
+}
+
 type serverAddr struct {
 	host string
 	port string
@@ -31,7 +274,7 @@ func FormatServer(host, port string) string {
 		return ""
 	}
 
-	return fmt.Sprintf("%s:%s", host, port)
+	return net.JoinHostPort(host, port)
 }
 
 func cleanOutput(s string) string {
@@ -43,6 +286,9 @@ func ParseServerString(server string) serverAddr {
 	if server == "" {
 		return serverAddr{}
 	}
+	if host, port, err := net.SplitHostPort(server); err == nil {
+		return serverAddr{host: host, port: port}
+	}
 	lastIndex := strings.LastIndex(server, ":")
 	if lastIndex == -1 {
 		return serverAddr{}
@@ -0,0 +1,278 @@
+//go:build linux
+
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/metacubex/bbolt"
+)
+
+// 容器运行时的代理：守护进程通过 systemd drop-in 读取代理环境变量，
+// docker 客户端配置中的代理会注入到新建的容器
+const (
+	systemdUnitDir   = "/etc/systemd/system"
+	serviceDropIn    = "90-sparkle-proxy.conf"
+	dockerClientFile = ".docker/config.json"
+	podmanConfFile   = ".config/containers/containers.conf"
+)
+
+// proxyServices 为通过 drop-in 设置代理的守护进程
+var proxyServices = map[string]string{
+	"docker":     "docker.service",
+	"containerd": "containerd.service",
+}
+
+var serviceProxyKeys = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"}
+
+// serviceProxyEnv 返回守护进程使用的代理环境变量，没有 HTTP 代理时为空
+func serviceProxyEnv(env map[string]string) []string {
+	httpProxy := firstHTTPProxy(env["http_proxy"], env["all_proxy"])
+	if httpProxy == "" {
+		return nil
+	}
+	vars := []string{
+		"HTTP_PROXY=" + httpProxy,
+		"HTTPS_PROXY=" + firstHTTPProxy(env["https_proxy"], httpProxy),
+	}
+	if bypass := env["no_proxy"]; bypass != "" {
+		vars = append(vars, "NO_PROXY="+bypass)
+	}
+	return vars
+}
+
+func serviceDropInPath(unit string) string {
+	return filepath.Join(systemdUnitDir, unit+".d", serviceDropIn)
+}
+
+// writeServiceProxy 写入或删除守护进程的代理 drop-in，修改后重新加载 systemd，
+// 正在运行的守护进程需要重启后生效
+func writeServiceProxy(unit string, vars []string) error {
+	var data []byte
+	if len(vars) > 0 {
+		if serviceProperty(unit, "LoadState") != "loaded" {
+			return fmt.Errorf("未安装 %s", unit)
+		}
+		var buf bytes.Buffer
+		buf.WriteString("# 由 Sparkle 管理，请勿手动修改\n[Service]\n")
+		for _, v := range vars {
+			fmt.Fprintf(&buf, "Environment=%q\n", v)
+		}
+		data = buf.Bytes()
+	}
+
+	path := serviceDropInPath(unit)
+	current, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if bytes.Equal(current, data) {
+		return nil
+	}
+	if data == nil {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		// 目录中没有其他 drop-in 时一并删除
+		_ = os.Remove(filepath.Dir(path))
+	} else {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	if output, err := exec.Command("systemctl", "daemon-reload").CombinedOutput(); err != nil {
+		return fmt.Errorf("重新加载 systemd 失败：%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func serviceProperty(unit, property string) string {
+	output, err := exec.Command("systemctl", "show", "--property", property, "--value", unit).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// serviceRestartRequired 比较守护进程当前的代理环境变量与 systemd 中的配置
+func serviceRestartRequired(unit string) bool {
+	pid, err := strconv.Atoi(serviceProperty(unit, "MainPID"))
+	if err != nil || pid == 0 {
+		return false
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return false
+	}
+	running := filterProxyVars(strings.Split(string(data), "\x00"))
+	configured := filterProxyVars(strings.Fields(serviceProperty(unit, "Environment")))
+	return !slices.Equal(running, configured)
+}
+
+func filterProxyVars(vars []string) []string {
+	var result []string
+	for _, v := range vars {
+		if name, _, ok := strings.Cut(v, "="); ok && slices.Contains(serviceProxyKeys, name) {
+			result = append(result, v)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
+
+// dockerProxies 为 docker 客户端配置中的 proxies.default
+type dockerProxies struct {
+	HTTPProxy  string `json:"httpProxy,omitempty"`
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	NoProxy    string `json:"noProxy,omitempty"`
+}
+
+// dockerProxyBackup 为写入前用户原有的 proxies.default，为空表示原本没有设置
+type dockerProxyBackup struct {
+	Default json.RawMessage `json:"default,omitempty"`
+}
+
+func dockerBackupKey(uid uint32) []byte {
+	return []byte(fmt.Sprintf("docker-client/%d", uid))
+}
+
+// writeDockerClientProxy 修改 ~/.docker/config.json 中的默认代理，首次修改前保存原有设置，
+// 删除时恢复原有设置，其余配置保持不变
+func writeDockerClientProxy(s *Session, env map[string]string) error {
+	path := filepath.Join(s.homeDir, dockerClientFile)
+	backup, err := loadDockerBackup(s.uid)
+	if err != nil {
+		return err
+	}
+	vars := serviceProxyEnv(env)
+	if len(vars) == 0 && backup == nil {
+		return nil
+	}
+
+	data, err := readUserFile(s, path)
+	if err != nil {
+		return err
+	}
+	config := map[string]json.RawMessage{}
+	proxies := map[string]json.RawMessage{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("无法解析 %s：%v", path, err)
+		}
+	}
+	if raw, ok := config["proxies"]; ok {
+		if err := json.Unmarshal(raw, &proxies); err != nil {
+			return fmt.Errorf("无法解析 %s：%v", path, err)
+		}
+	}
+
+	if len(vars) > 0 {
+		if backup == nil {
+			if err := saveDockerBackup(s.uid, &dockerProxyBackup{Default: proxies["default"]}); err != nil {
+				return err
+			}
+		}
+		proxy := dockerProxies{}
+		for _, v := range vars {
+			name, value, _ := strings.Cut(v, "=")
+			switch name {
+			case "HTTP_PROXY":
+				proxy.HTTPProxy = value
+			case "HTTPS_PROXY":
+				proxy.HTTPSProxy = value
+			case "NO_PROXY":
+				proxy.NoProxy = value
+			}
+		}
+		proxies["default"], _ = json.Marshal(proxy)
+	} else if backup.Default != nil {
+		proxies["default"] = backup.Default
+	} else {
+		delete(proxies, "default")
+	}
+
+	if len(proxies) > 0 {
+		config["proxies"], _ = json.Marshal(proxies)
+	} else {
+		delete(config, "proxies")
+	}
+	if len(config) == 0 {
+		err = removeUserFile(s, path)
+	} else {
+		output, _ := json.MarshalIndent(config, "", "\t")
+		err = writeUserFile(s, path, append(output, '\n'))
+	}
+	if err != nil {
+		return err
+	}
+	if len(vars) == 0 {
+		return deleteDockerBackup(s.uid)
+	}
+	return nil
+}
+
+func loadDockerBackup(uid uint32) (*dockerProxyBackup, error) {
+	db, err := openCacheDB()
+	if err != nil {
+		return nil, err
+	}
+	var backup *dockerProxyBackup
+	err = db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte(proxySnapshotBucket)).Get(dockerBackupKey(uid))
+		if data == nil {
+			return nil
+		}
+		backup = &dockerProxyBackup{}
+		return json.Unmarshal(data, backup)
+	})
+	return backup, err
+}
+
+func saveDockerBackup(uid uint32, backup *dockerProxyBackup) error {
+	data, err := json.Marshal(backup)
+	if err != nil {
+		return err
+	}
+	db, err := openCacheDB()
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(proxySnapshotBucket)).Put(dockerBackupKey(uid), data)
+	})
+}
+
+func deleteDockerBackup(uid uint32) error {
+	db, err := openCacheDB()
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(proxySnapshotBucket)).Delete(dockerBackupKey(uid))
+	})
+}
+
+// podmanEngineEnv 生成 containers.conf 中 [engine] 节的 env 设置
+func podmanEngineEnv(env map[string]string) []string {
+	vars := serviceProxyEnv(env)
+	if len(vars) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(vars))
+	for i, v := range vars {
+		quoted[i] = strconv.Quote(v)
+	}
+	return []string{"env = [" + strings.Join(quoted, ", ") + "]"}
+}
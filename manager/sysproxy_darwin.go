@@ -9,7 +9,14 @@ import (
 	"sync"
 )
 
-func DisableProxy(_ string, _ uint32) error {
+// macOS 的代理设置由 networksetup 按网络服务统一管理
+const darwinProxyBackend = "networksetup"
+
+func proxyBackend(_ string, _ uint32) (string, error) {
+	return darwinProxyBackend, nil
+}
+
+func disableSystemProxy(_ string, _ uint32) error {
 	services, err := getNetworkServices()
 	if err != nil {
 		return err
@@ -23,93 +30,28 @@ func DisableProxy(_ string, _ uint32) error {
 		{"-setsocksfirewallproxystate", "off"},
 	}
 
-	errChan := make(chan error, len(services))
-	var wg sync.WaitGroup
-
-	for _, service := range services {
-		wg.Add(1)
-		go func(svc string) {
-			defer wg.Done()
-			if err := execNetworksetupConcurrent(svc, commands); err != nil {
-				errChan <- err
-			}
-		}(service)
-	}
-
-	go func() {
-		wg.Wait()
-		close(errChan)
-	}()
-
-	for err := range errChan {
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return applyNetworksetup(services, commands)
 }
 
-func SetProxy(proxy, bypass, _ string, _ uint32) error {
-	if proxy == "" || bypass == "" {
-		config, err := QueryProxySettings("", 0)
-		if err != nil {
-			return err
-		}
-
-		if proxy == "" {
-			proxy = config.Proxy.Servers["http_server"]
-		}
-		if bypass == "" {
-			bypass = config.Proxy.Bypass
-		}
-	}
-
-	addr := ParseServerString(proxy)
-	if addr.host == "" || addr.port == "" {
-		return fmt.Errorf("invalid proxy address: %s", proxy)
-	}
-
+func setSystemProxy(config *ProxyConfig, _ string, _ uint32) error {
 	services, err := getNetworkServices()
 	if err != nil {
 		return err
 	}
 
-	commands := [][]string{
+	proxy, err := proxyCommands(config)
+	if err != nil {
+		return err
+	}
+	commands := append([][]string{
 		{"-setautoproxystate", "off"},
 		{"-setproxyautodiscovery", "off"},
-		{"-setwebproxy", addr.host, addr.port},
-		{"-setsecurewebproxy", addr.host, addr.port},
-		{"-setsocksfirewallproxy", addr.host, addr.port},
-		{"-setproxybypassdomains", bypass},
-	}
-
-	errChan := make(chan error, len(services))
-	var wg sync.WaitGroup
-
-	for _, service := range services {
-		wg.Add(1)
-		go func(svc string) {
-			defer wg.Done()
-			if err := execNetworksetupConcurrent(svc, commands); err != nil {
-				errChan <- err
-			}
-		}(service)
-	}
+	}, proxy...)
 
-	go func() {
-		wg.Wait()
-		close(errChan)
-	}()
-
-	for err := range errChan {
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return applyNetworksetup(services, commands)
 }
 
-func SetPac(pacUrl, _ string, _ uint32) error {
+func setSystemPac(pacUrl, _ string, _ uint32) error {
 	if pacUrl == "" {
 		config, err := QueryProxySettings("", 0)
 		if err != nil {
@@ -132,30 +74,7 @@ func SetPac(pacUrl, _ string, _ uint32) error {
 		{"-setproxyautodiscovery", "on"},
 	}
 
-	errChan := make(chan error, len(services))
-	var wg sync.WaitGroup
-
-	for _, service := range services {
-		wg.Add(1)
-		go func(svc string) {
-			defer wg.Done()
-			if err := execNetworksetupConcurrent(svc, commands); err != nil {
-				errChan <- err
-			}
-		}(service)
-	}
-
-	go func() {
-		wg.Wait()
-		close(errChan)
-	}()
-
-	for err := range errChan {
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return applyNetworksetup(services, commands)
 }
 
 func QueryProxySettings(_ string, _ uint32) (*ProxyConfig, error) {
@@ -179,32 +98,117 @@ func QueryProxySettings(_ string, _ uint32) (*ProxyConfig, error) {
 		}
 	}
 
-	output, err = exec.Command("networksetup", "-getwebproxy", service).Output()
-	if err == nil && strings.Contains(string(output), "Enabled: Yes") {
-		config.Proxy.Enable = true
-		lines := strings.Split(string(output), "\n")
-		if config.Proxy.Servers == nil {
-			config.Proxy.Servers = make(map[string]string)
+	config.Proxy.Servers = make(map[string]string)
+	for key, flag := range map[string]string{
+		"http_server":  "-getwebproxy",
+		"https_server": "-getsecurewebproxy",
+		"socks_server": "-getsocksfirewallproxy",
+		"ftp_server":   "-getftpproxy",
+	} {
+		output, err = exec.Command("networksetup", flag, service).Output()
+		if err != nil || !strings.Contains(string(output), "Enabled: Yes") {
+			continue
 		}
+		config.Proxy.Enable = true
 		var host, port string
-		for _, line := range lines {
+		for _, line := range strings.Split(string(output), "\n") {
 			if strings.HasPrefix(line, "Server: ") {
 				host = strings.TrimPrefix(line, "Server: ")
 			} else if strings.HasPrefix(line, "Port: ") {
 				port = strings.TrimPrefix(line, "Port: ")
 			}
 		}
-		config.Proxy.Servers["http_server"] = FormatServer(host, port)
+		config.Proxy.Servers[key] = FormatServer(host, port)
 	}
 
+	config.Proxy.SameForAll = config.Proxy.Servers["http_server"] == config.Proxy.Servers["https_server"] &&
+		config.Proxy.Servers["http_server"] == config.Proxy.Servers["socks_server"]
+
 	output, err = exec.Command("networksetup", "-getproxybypassdomains", service).Output()
-	if err == nil {
-		config.Proxy.Bypass = strings.TrimSpace(string(output))
+	if err == nil && !strings.HasPrefix(string(output), "There aren't any") {
+		config.Proxy.Bypass = parseNativeBypass(strings.Fields(string(output))).String()
 	}
 
 	return config, nil
 }
 
+// restoreProxy 将快照中的设置写回全部网络服务
+func restoreProxy(_ string, _ uint32, config *ProxyConfig) error {
+	services, err := getNetworkServices()
+	if err != nil {
+		return err
+	}
+
+	commands, err := proxyCommands(config)
+	if err != nil {
+		return err
+	}
+	if config.PAC.Enable {
+		commands = append(commands,
+			[]string{"-setautoproxyurl", config.PAC.URL},
+			[]string{"-setautoproxystate", "on"},
+		)
+	} else {
+		commands = append(commands, []string{"-setautoproxystate", "off"})
+	}
+	return applyNetworksetup(services, commands)
+}
+
+// proxyCommands 按协议设置或关闭代理，未指定服务器的协议会被关闭
+func proxyCommands(config *ProxyConfig) ([][]string, error) {
+	domains, err := splitBypass(config.Proxy.Bypass).Networksetup()
+	if err != nil {
+		return nil, err
+	}
+	if len(domains) == 0 {
+		domains = []string{"Empty"}
+	}
+
+	var commands [][]string
+	for key, flag := range map[string]string{
+		"http_server":  "-setwebproxy",
+		"https_server": "-setsecurewebproxy",
+		"socks_server": "-setsocksfirewallproxy",
+		"ftp_server":   "-setftpproxy",
+	} {
+		addr := ParseServerString(config.Proxy.Servers[key])
+		if config.Proxy.Enable && addr.host != "" {
+			commands = append(commands, []string{flag, addr.host, addr.port})
+		} else {
+			commands = append(commands, []string{flag + "state", "off"})
+		}
+	}
+
+	return append(commands, append([]string{"-setproxybypassdomains"}, domains...)), nil
+}
+
+func applyNetworksetup(services []string, commands [][]string) error {
+	errChan := make(chan error, len(services))
+	var wg sync.WaitGroup
+
+	for _, service := range services {
+		wg.Add(1)
+		go func(svc string) {
+			defer wg.Done()
+			if err := execNetworksetupConcurrent(svc, commands); err != nil {
+				errChan <- err
+			}
+		}(service)
+	}
+
+	go func() {
+		wg.Wait()
+		close(errChan)
+	}()
+
+	for err := range errChan {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func getNetworkServices() ([]string, error) {
 	output, err := exec.Command("networksetup", "-listnetworkserviceorder").Output()
 	if err != nil {
@@ -0,0 +1,196 @@
+//go:build linux
+
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// XFCE、LXQt 等没有统一代理设置的桌面通过会话环境变量传递代理，
+// 写入 systemd 的 environment.d 并同步到正在运行的用户会话
+const envProxyFile = ".config/environment.d/90-sparkle-proxy.conf"
+
+var envProxyKeys = []string{
+	"http_proxy", "https_proxy", "ftp_proxy", "all_proxy", "no_proxy", "auto_proxy",
+}
+
+func envProxyPath(s *Session) string {
+	return filepath.Join(s.homeDir, envProxyFile)
+}
+
+func queryEnvSettings(s *Session) (*ProxyConfig, error) {
+	data, err := readUserFile(s, envProxyPath(s))
+	if err != nil {
+		return nil, fmt.Errorf("无法读取代理环境变量：%v", err)
+	}
+
+	env := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			env[strings.ToLower(key)] = strings.Trim(value, `"'`)
+		}
+	}
+
+	config := &ProxyConfig{}
+	config.Proxy.Enable = env["http_proxy"] != "" || env["all_proxy"] != ""
+	config.Proxy.Servers = map[string]string{
+		"http_server":  stripProxyScheme(env["http_proxy"]),
+		"https_server": stripProxyScheme(env["https_proxy"]),
+		"socks_server": stripProxyScheme(env["all_proxy"]),
+		"ftp_server":   stripProxyScheme(env["ftp_proxy"]),
+	}
+	config.Proxy.SameForAll = config.Proxy.Servers["http_server"] == config.Proxy.Servers["https_server"] &&
+		config.Proxy.Servers["http_server"] == config.Proxy.Servers["socks_server"]
+	config.Proxy.Bypass = parseNativeBypass(strings.Split(env["no_proxy"], ",")).String()
+	config.PAC.Enable = env["auto_proxy"] != ""
+	config.PAC.URL = env["auto_proxy"]
+
+	return config, nil
+}
+
+func setEnvProxy(s *Session, config *ProxyConfig) error {
+	env, err := proxyEnv(config)
+	if err != nil {
+		return err
+	}
+	return writeEnvProxy(s, env)
+}
+
+// proxyEnv 返回代理设置对应的环境变量，键为小写变量名
+func proxyEnv(config *ProxyConfig) (map[string]string, error) {
+	env := map[string]string{}
+	if server := config.Proxy.Servers["http_server"]; server != "" {
+		env["http_proxy"] = "http://" + server
+	}
+	if server := config.Proxy.Servers["https_server"]; server != "" {
+		env["https_proxy"] = "http://" + server
+	}
+	if server := config.Proxy.Servers["ftp_server"]; server != "" {
+		env["ftp_proxy"] = "http://" + server
+	}
+	if server := config.Proxy.Servers["socks_server"]; server != "" {
+		env["all_proxy"] = "socks5://" + server
+	}
+	bypass, err := splitBypass(config.Proxy.Bypass).Env()
+	if err != nil {
+		return nil, err
+	}
+	if bypass != "" {
+		env["no_proxy"] = bypass
+	}
+	return env, nil
+}
+
+func setEnvPac(s *Session, config *ProxyConfig) error {
+	return writeEnvProxy(s, map[string]string{"auto_proxy": config.PAC.URL})
+}
+
+func clearEnvProxy(s *Session) error {
+	return writeEnvProxy(s, nil)
+}
+
+// writeEnvProxy 写入代理环境变量，env 为空时删除配置文件。
+// 会话中只取消之前由服务写入的变量，用户自行设置的变量不受影响
+func writeEnvProxy(s *Session, env map[string]string) error {
+	previous, err := readUserFile(s, envProxyPath(s))
+	if err != nil {
+		return fmt.Errorf("无法读取代理环境变量：%v", err)
+	}
+	written := map[string]bool{}
+	for _, line := range strings.Split(string(previous), "\n") {
+		if name, _, ok := strings.Cut(strings.TrimSpace(line), "="); ok && !strings.HasPrefix(name, "#") {
+			written[name] = true
+		}
+	}
+
+	var (
+		buf   bytes.Buffer
+		set   []string
+		unset []string
+	)
+	buf.WriteString("# 由 Sparkle 管理，请勿手动修改\n")
+	for _, key := range envProxyKeys {
+		for _, name := range []string{key, strings.ToUpper(key)} {
+			if value, ok := env[key]; ok {
+				fmt.Fprintf(&buf, "%s=%s\n", name, value)
+				set = append(set, name+"="+value)
+			} else if written[name] {
+				unset = append(unset, name)
+			}
+		}
+	}
+
+	if len(env) == 0 {
+		if err := removeUserFile(s, envProxyPath(s)); err != nil {
+			return fmt.Errorf("无法删除代理环境变量：%v", err)
+		}
+	} else if err := writeUserFile(s, envProxyPath(s), buf.Bytes()); err != nil {
+		return fmt.Errorf("无法写入代理环境变量：%v", err)
+	}
+
+	// 同步到当前会话，未使用 systemd 用户会话时忽略错误，下次登录生效
+	if len(set) > 0 {
+		_ = s.command("systemctl", append([]string{"--user", "set-environment"}, set...)...).Run()
+	}
+	if len(unset) > 0 {
+		_ = s.command("systemctl", append([]string{"--user", "unset-environment"}, unset...)...).Run()
+	}
+	return nil
+}
+
+func stripProxyScheme(value string) string {
+	if _, rest, ok := strings.Cut(value, "://"); ok {
+		value = rest
+	}
+	return strings.TrimSuffix(value, "/")
+}
+
+// readUserFile 以用户身份读取文件，避免通过用户可控的符号链接读取其他文件
+func readUserFile(s *Session, path string) ([]byte, error) {
+	if _, err := os.Lstat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	var stderr bytes.Buffer
+	cmd := execUserShell(s, `cat -- "$1"`, path)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// writeUserFile 以用户身份写入文件，文件属主与权限与用户自行创建时一致
+func writeUserFile(s *Session, path string, data []byte) error {
+	cmd := execUserShell(s, `mkdir -p -- "$1" && cat > "$2"`, filepath.Dir(path), path)
+	cmd.Stdin = bytes.NewReader(data)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func removeUserFile(s *Session, path string) error {
+	if output, err := execUserShell(s, `rm -f -- "$1"`, path).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func execUserShell(s *Session, script string, args ...string) *exec.Cmd {
+	cmd := s.command("/bin/sh", append([]string{"-c", script, "sh"}, args...)...)
+	cmd.Env = append(cmd.Env, "PATH="+os.Getenv("PATH"))
+	return cmd
+}
@@ -0,0 +1,296 @@
+package manager
+
+import (
+	"cmp"
+	"log"
+	"maps"
+	"slices"
+	"sparkle-service/config"
+	"sync"
+	"time"
+)
+
+const (
+	guardPollInterval = 30 * time.Second
+	guardDebounce     = 2 * time.Second
+	guardMaxEvents    = 50
+)
+
+// GuardEvent 记录一次守护介入
+type GuardEvent struct {
+	Time    time.Time    `json:"time"`
+	Backend string       `json:"backend"`
+	UID     uint32       `json:"uid"`
+	Found   *ProxyConfig `json:"found"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// GuardStatus 为代理守护的当前状态，Users 为各用户的守护
+type GuardStatus struct {
+	Enabled bool              `json:"enabled"`
+	Users   []UserGuardStatus `json:"users"`
+}
+
+// UserGuardStatus 为一个用户的代理守护状态，Watchers 与 Desired 以后端为键
+type UserGuardStatus struct {
+	UID           uint32                  `json:"uid"`
+	Active        bool                    `json:"active"`
+	Backends      []string                `json:"backends"`
+	Watchers      map[string]string       `json:"watchers,omitempty"`
+	Desired       map[string]*ProxyConfig `json:"desired,omitempty"`
+	Interventions int                     `json:"interventions"`
+	Events        []GuardEvent            `json:"events"`
+}
+
+// guard 在系统代理被其他程序修改后重新应用最近一次由服务为该用户设置的状态，
+// 同时设置多个后端时分别守护每个后端
+type guard struct {
+	mutex         sync.Mutex
+	uid           uint32
+	tracked       bool
+	generation    uint64
+	backends      []string
+	desired       map[string]*ProxyConfig
+	watchers      map[string]string
+	stop          chan struct{}
+	interventions int
+	events        []GuardEvent
+}
+
+var (
+	guardsMutex sync.Mutex
+	proxyGuards = map[uint32]*guard{}
+)
+
+// proxyGuard 返回 uid 对应的守护，各用户的守护互不影响
+func proxyGuard(uid uint32) *guard {
+	guardsMutex.Lock()
+	defer guardsMutex.Unlock()
+	g, ok := proxyGuards[uid]
+	if !ok {
+		g = &guard{uid: uid}
+		proxyGuards[uid] = g
+	}
+	return g
+}
+
+// allGuards 返回按 uid 排序的全部守护
+func allGuards() []*guard {
+	guardsMutex.Lock()
+	defer guardsMutex.Unlock()
+	guards := make([]*guard, 0, len(proxyGuards))
+	for _, g := range proxyGuards {
+		guards = append(guards, g)
+	}
+	slices.SortFunc(guards, func(a, b *guard) int {
+		return cmp.Compare(a.uid, b.uid)
+	})
+	return guards
+}
+
+// track 记录最近一次设置的全部后端，启用守护时以当前设置作为期望状态
+func (g *guard) track(backends []string) {
+	g.mutex.Lock()
+	g.tracked, g.backends = true, slices.Clone(backends)
+	g.generation++
+	g.mutex.Unlock()
+
+	if config.GetSysproxyGuard() {
+		g.start()
+	}
+}
+
+// untrack 代理由服务修改、关闭或恢复前停止守护，返回时不会再有进行中的重新应用
+func (g *guard) untrack() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.tracked = false
+	g.generation++
+	g.stopLocked()
+}
+
+func (g *guard) start() {
+	g.mutex.Lock()
+	backends, uid, tracked, generation := g.backends, g.uid, g.tracked, g.generation
+	g.mutex.Unlock()
+	if !tracked {
+		return
+	}
+
+	desired := map[string]*ProxyConfig{}
+	for _, backend := range backends {
+		current, err := QueryProxySettings(backend, uid)
+		if err != nil {
+			log.Printf("代理守护读取 %s 当前设置失败: %v", backend, err)
+			return
+		}
+		// 未启用代理的后端无需守护
+		if current.Proxy.Enable || current.PAC.Enable {
+			desired[backend] = current
+		}
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	// 读取期间代理可能已被服务再次修改
+	if g.generation != generation {
+		return
+	}
+	g.stopLocked()
+	if len(desired) == 0 {
+		return
+	}
+	g.desired = desired
+	g.watchers = map[string]string{}
+	g.stop = make(chan struct{})
+	for backend := range desired {
+		go g.run(backend, uid, g.stop)
+	}
+}
+
+func (g *guard) stopLocked() {
+	if g.stop != nil {
+		close(g.stop)
+		g.stop = nil
+	}
+	g.desired = nil
+	g.watchers = nil
+}
+
+func (g *guard) run(backend string, uid uint32, stop chan struct{}) {
+	watcher, changes := watchProxyChanges(backend, uid, stop)
+	g.mutex.Lock()
+	if g.stop == stop {
+		g.watchers[backend] = watcher
+	}
+	g.mutex.Unlock()
+
+	ticker := time.NewTicker(guardPollInterval)
+	defer ticker.Stop()
+	debounce := time.NewTimer(guardDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-changes:
+			debounce.Reset(guardDebounce)
+		case <-debounce.C:
+			g.check(backend, uid, stop)
+		case <-ticker.C:
+			g.check(backend, uid, stop)
+		}
+	}
+}
+
+// check 在当前设置偏离期望状态时重新应用
+func (g *guard) check(backend string, uid uint32, stop chan struct{}) {
+	g.mutex.Lock()
+	desired := g.desired[backend]
+	if g.stop != stop {
+		desired = nil
+	}
+	g.mutex.Unlock()
+	if desired == nil {
+		return
+	}
+
+	current, err := QueryProxySettings(backend, uid)
+	if err != nil {
+		log.Printf("代理守护读取当前设置失败: %v", err)
+		return
+	}
+	if proxyMatches(desired, current) {
+		return
+	}
+
+	// 持锁重新应用，读取期间服务可能已修改代理或停止守护，此时不能覆盖新的设置
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.stop != stop || g.desired[backend] != desired {
+		return
+	}
+
+	event := GuardEvent{Time: time.Now(), Backend: backend, UID: uid, Found: current}
+	if err := restoreProxy(backend, uid, desired); err != nil {
+		event.Error = err.Error()
+		log.Printf("代理守护重新应用设置失败: %v", err)
+	} else {
+		log.Printf("系统代理被修改，代理守护已重新应用设置")
+	}
+
+	g.interventions++
+	g.events = append(g.events, event)
+	if len(g.events) > guardMaxEvents {
+		g.events = g.events[len(g.events)-guardMaxEvents:]
+	}
+}
+
+// proxyMatches 只比较代理模式、各协议的服务器与 PAC 地址，忽略各平台对例外列表的格式差异
+func proxyMatches(desired, current *ProxyConfig) bool {
+	if desired.PAC.Enable != current.PAC.Enable || desired.Proxy.Enable != current.Proxy.Enable {
+		return false
+	}
+	if desired.PAC.Enable && desired.PAC.URL != current.PAC.URL {
+		return false
+	}
+	if desired.Proxy.Enable {
+		for key, server := range desired.Proxy.Servers {
+			if current.Proxy.Servers[key] != server {
+				return false
+			}
+		}
+		for key, server := range current.Proxy.Servers {
+			if desired.Proxy.Servers[key] != server {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ProxyGuardStatus 返回各用户代理守护的状态与最近的介入记录
+func ProxyGuardStatus() GuardStatus {
+	status := GuardStatus{
+		Enabled: config.GetSysproxyGuard(),
+		Users:   []UserGuardStatus{},
+	}
+	for _, g := range allGuards() {
+		g.mutex.Lock()
+		user := UserGuardStatus{
+			UID:           g.uid,
+			Active:        g.stop != nil,
+			Backends:      []string{},
+			Watchers:      maps.Clone(g.watchers),
+			Desired:       maps.Clone(g.desired),
+			Interventions: g.interventions,
+			Events:        append([]GuardEvent{}, g.events...),
+		}
+		if g.tracked {
+			user.Backends = slices.Clone(g.backends)
+		}
+		g.mutex.Unlock()
+		status.Users = append(status.Users, user)
+	}
+	return status
+}
+
+// SetProxyGuard 开启或关闭全部用户的代理守护
+func SetProxyGuard(enable bool) error {
+	if err := config.UpdateSysproxyConfig(nil, &enable); err != nil {
+		return err
+	}
+	for _, g := range allGuards() {
+		if enable {
+			g.start()
+			continue
+		}
+		g.mutex.Lock()
+		g.generation++
+		g.stopLocked()
+		g.mutex.Unlock()
+	}
+	return nil
+}
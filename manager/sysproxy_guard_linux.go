@@ -0,0 +1,150 @@
+//go:build linux
+
+package manager
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"github.com/godbus/dbus/v5"
+	"golang.org/x/sys/unix"
+)
+
+// watchProxyChanges 监听桌面代理设置的变化，无法监听时只依靠定时检查
+func watchProxyChanges(desktop string, uid uint32, stop <-chan struct{}) (string, <-chan struct{}) {
+	// NetworkManager 为系统级设置，不需要用户会话
+	if desktop == "networkmanager" {
+		return "poll", nil
+	}
+	s, err := getSession(uid)
+	if err != nil {
+		return "poll", nil
+	}
+
+	var (
+		watcher string
+		changes <-chan struct{}
+	)
+	switch desktop {
+	case "gnome", "cinnamon", "mate", "budgie", "deepin":
+		watcher = "dconf"
+		changes, err = watchDconf(s, proxySchema(s, desktop), stop)
+	case "kde", "kde5", "kde6":
+		watcher = "kioslaverc"
+		changes, err = watchFile(filepath.Join(s.homeDir, ".config", "kioslaverc"), stop)
+	case "xfce", "lxqt":
+		watcher = "environment.d"
+		changes, err = watchFile(envProxyPath(s), stop)
+	default:
+		return "poll", nil
+	}
+	if err != nil {
+		log.Printf("无法监听代理设置变化，改为定时检查: %v", err)
+		return "poll", nil
+	}
+	return watcher, changes
+}
+
+// watchDconf 订阅 dconf 写入服务的变更通知
+func watchDconf(s *Session, schema string, stop <-chan struct{}) (<-chan struct{}, error) {
+	conn, err := s.connectBus()
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchInterface("ca.desrt.dconf.Writer"),
+		dbus.WithMatchMember("Notify"),
+	); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	base, known := dconfKeyPath(schema, "")
+	changes := make(chan struct{}, 1)
+	go func() {
+		<-stop
+		conn.Close()
+	}()
+	go func() {
+		for signal := range signals {
+			if known && !dconfNotifyMatches(signal, base) {
+				continue
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// dconfNotifyMatches 判断变更通知是否涉及 base 路径下的键
+func dconfNotifyMatches(signal *dbus.Signal, base string) bool {
+	if len(signal.Body) < 2 {
+		return true
+	}
+	prefix, _ := signal.Body[0].(string)
+	keys, _ := signal.Body[1].([]string)
+	if len(keys) == 0 {
+		keys = []string{""}
+	}
+	for _, key := range keys {
+		path := prefix + key
+		if strings.HasPrefix(path, base) || strings.HasPrefix(base, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchFile 通过 inotify 监听文件所在目录，文件被替换时同样能收到通知
+func watchFile(path string, stop <-chan struct{}) (<-chan struct{}, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	mask := uint32(unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_CREATE | unix.IN_DELETE)
+	if _, err := unix.InotifyAddWatch(fd, filepath.Dir(path), mask); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	file := os.NewFile(uintptr(fd), "inotify")
+
+	name := filepath.Base(path)
+	changes := make(chan struct{}, 1)
+	go func() {
+		<-stop
+		file.Close()
+	}()
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				return
+			}
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				start := offset + unix.SizeofInotifyEvent
+				offset = start + int(event.Len)
+				if offset > n {
+					break
+				}
+				if strings.TrimRight(string(buf[start:offset]), "\x00") != name {
+					continue
+				}
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
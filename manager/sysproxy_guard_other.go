@@ -0,0 +1,8 @@
+//go:build !linux
+
+package manager
+
+// watchProxyChanges 其他平台没有统一的变更通知，只依靠定时检查
+func watchProxyChanges(_ string, _ uint32, _ <-chan struct{}) (string, <-chan struct{}) {
+	return "poll", nil
+}
@@ -0,0 +1,79 @@
+package manager
+
+import "testing"
+
+func TestProxyMatches(t *testing.T) {
+	proxy := func(servers map[string]string) *ProxyConfig {
+		config := &ProxyConfig{}
+		config.Proxy.Enable = true
+		config.Proxy.Servers = servers
+		return config
+	}
+	pac := func(url string) *ProxyConfig {
+		config := &ProxyConfig{}
+		config.PAC.Enable, config.PAC.URL = true, url
+		return config
+	}
+	desired := proxy(map[string]string{"http_server": "127.0.0.1:7890", "socks_server": "127.0.0.1:7891"})
+
+	for _, tt := range []struct {
+		name    string
+		desired *ProxyConfig
+		current *ProxyConfig
+		want    bool
+	}{
+		{"相同", desired, proxy(map[string]string{"http_server": "127.0.0.1:7890", "socks_server": "127.0.0.1:7891"}), true},
+		{"忽略例外列表", desired, func() *ProxyConfig {
+			config := proxy(map[string]string{"http_server": "127.0.0.1:7890", "socks_server": "127.0.0.1:7891"})
+			config.Proxy.Bypass = "localhost"
+			return config
+		}(), true},
+		{"SOCKS 被修改", desired, proxy(map[string]string{"http_server": "127.0.0.1:7890", "socks_server": "127.0.0.1:1080"}), false},
+		{"新增 HTTPS", desired, proxy(map[string]string{"http_server": "127.0.0.1:7890", "https_server": "127.0.0.1:8080", "socks_server": "127.0.0.1:7891"}), false},
+		{"被关闭", desired, &ProxyConfig{}, false},
+		{"PAC 相同", pac("http://127.0.0.1:10011/pac/a.pac"), pac("http://127.0.0.1:10011/pac/a.pac"), true},
+		{"PAC 被修改", pac("http://127.0.0.1:10011/pac/a.pac"), pac("http://example.com/a.pac"), false},
+	} {
+		if got := proxyMatches(tt.desired, tt.current); got != tt.want {
+			t.Errorf("proxyMatches(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// 关闭或恢复一个用户的代理不影响其他用户的守护
+func TestProxyGuardPerUser(t *testing.T) {
+	a, b := proxyGuard(1001), proxyGuard(1002)
+	defer func() {
+		guardsMutex.Lock()
+		delete(proxyGuards, 1001)
+		delete(proxyGuards, 1002)
+		guardsMutex.Unlock()
+	}()
+	if a == b || proxyGuard(1001) != a {
+		t.Fatal("proxyGuard() 未按 uid 区分守护")
+	}
+
+	a.track([]string{"gnome"})
+	b.track([]string{"kde", "networkmanager"})
+	// 模拟正在运行的守护
+	stop := make(chan struct{})
+	b.mutex.Lock()
+	b.stop = stop
+	b.mutex.Unlock()
+
+	a.untrack()
+	select {
+	case <-stop:
+		t.Fatal("untrack() 停止了其他用户的守护")
+	default:
+	}
+
+	backends := map[uint32][]string{}
+	for _, user := range ProxyGuardStatus().Users {
+		backends[user.UID] = user.Backends
+	}
+	if len(backends[1001]) != 0 || len(backends[1002]) != 2 {
+		t.Errorf("ProxyGuardStatus() backends = %v", backends)
+	}
+	b.untrack()
+}
@@ -4,111 +4,86 @@ package manager
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
-	"os/user"
+	"log"
+	"slices"
+	"strconv"
 	"strings"
-	"syscall"
 )
 
-type Session struct {
-	uid      uint32
-	gid      uint32
-	dbusAddr string
-	homeDir  string
+// proxyBackend 返回用户实际使用的桌面
+func proxyBackend(desktop string, uid uint32) (string, error) {
+	_, desktop, err := userSession(desktop, uid)
+	return desktop, err
 }
 
-var currentSession *Session
-
-func initSession(uid uint32) error {
-	if currentSession != nil {
-		return nil
-	}
-
-	currentSession = &Session{
-		uid: uid,
-		gid: uid,
+// userSession 返回 uid 的会话与检测后的桌面
+func userSession(desktop string, uid uint32) (*Session, string, error) {
+	// NetworkManager 为系统级设置，不需要用户会话
+	if desktop == "networkmanager" {
+		return nil, desktop, nil
 	}
-
-	u, err := user.LookupId(fmt.Sprint(uid))
+	s, err := getSession(uid)
 	if err != nil {
-		return fmt.Errorf("failed to lookup user: %v", err)
+		return nil, "", err
 	}
-	currentSession.homeDir = u.HomeDir
-
-	userRuntime := fmt.Sprintf("/run/user/%d", currentSession.uid)
-	if _, err := os.Stat(userRuntime); err != nil {
-		return fmt.Errorf("user runtime directory not found: %v", err)
+	desktop, err = resolveDesktop(desktop, uid)
+	if err != nil {
+		return nil, "", err
 	}
-	currentSession.dbusAddr = fmt.Sprintf("unix:path=%s/bus", userRuntime)
-
-	return nil
+	return s, desktop, nil
 }
 
-func DisableProxy(desktop string, uid uint32) error {
-	if err := initSession(uid); err != nil {
+func disableSystemProxy(desktop string, uid uint32) error {
+	s, desktop, err := userSession(desktop, uid)
+	if err != nil {
 		return err
 	}
 
 	switch desktop {
 	case "kde":
-		return clearKDEProxy(false)
+		return clearKDEProxy(s, false)
 	case "kde5":
-		return clearKDEProxy(false)
+		return clearKDEProxy(s, false)
 	case "kde6":
-		return clearKDEProxy(true)
-	case "gnome":
-		return clearGnomeProxy()
+		return clearKDEProxy(s, true)
+	case "gnome", "cinnamon", "mate", "budgie", "deepin":
+		return clearGnomeProxy(s, proxySchema(s, desktop))
+	case "xfce", "lxqt":
+		return clearEnvProxy(s)
+	case "networkmanager":
+		return clearNMProxy()
 	default:
 		return fmt.Errorf("不支持的桌面：%s", desktop)
 	}
 }
 
-func SetProxy(proxy, bypass, desktop string, uid uint32) error {
-	if err := initSession(uid); err != nil {
+func setSystemProxy(config *ProxyConfig, desktop string, uid uint32) error {
+	s, desktop, err := userSession(desktop, uid)
+	if err != nil {
 		return err
 	}
 
-	if proxy == "" || bypass == "" {
-		config, err := QueryProxySettings(desktop, uid)
-		if err != nil {
-			return err
-		}
-
-		if proxy == "" {
-			proxy = config.Proxy.Servers["http_server"]
-		}
-		if bypass == "" {
-			bypass = config.Proxy.Bypass
-		}
-	}
-
-	config := &ProxyConfig{}
-	config.Proxy.Enable = true
-	config.Proxy.SameForAll = true
-	config.Proxy.Servers = map[string]string{
-		"http_server":  proxy,
-		"https_server": proxy,
-		"socks_server": proxy,
-	}
-	config.Proxy.Bypass = bypass
-
 	switch desktop {
 	case "kde":
-		return setKDEProxy(config, false)
+		return setKDEProxy(s, config, false)
 	case "kde5":
-		return setKDEProxy(config, false)
+		return setKDEProxy(s, config, false)
 	case "kde6":
-		return setKDEProxy(config, true)
-	case "gnome":
-		return setGnomeProxy(config)
+		return setKDEProxy(s, config, true)
+	case "gnome", "cinnamon", "mate", "budgie", "deepin":
+		return setGnomeProxy(s, proxySchema(s, desktop), config)
+	case "xfce", "lxqt":
+		return setEnvProxy(s, config)
+	case "networkmanager":
+		return setNMProxy(config)
 	default:
 		return fmt.Errorf("不支持的桌面：%s", desktop)
 	}
 }
 
-func SetPac(pacUrl, desktop string, uid uint32) error {
-	if err := initSession(uid); err != nil {
+func setSystemPac(pacUrl, desktop string, uid uint32) error {
+	s, desktop, err := userSession(desktop, uid)
+	if err != nil {
 		return err
 	}
 
@@ -127,78 +102,127 @@ func SetPac(pacUrl, desktop string, uid uint32) error {
 	switch desktop {
 
 	case "kde":
-		return setKDEPac(config, false)
+		return setKDEPac(s, config, false)
 	case "kde5":
-		return setKDEPac(config, false)
+		return setKDEPac(s, config, false)
 	case "kde6":
-		return setKDEPac(config, true)
-	case "gnome":
-		return setGnomePac(config)
+		return setKDEPac(s, config, true)
+	case "gnome", "cinnamon", "mate", "budgie", "deepin":
+		return setGnomePac(s, proxySchema(s, desktop), config)
+	case "xfce", "lxqt":
+		return setEnvPac(s, config)
+	case "networkmanager":
+		return setNMPac(config)
 	default:
 		return fmt.Errorf("不支持的桌面：%s", desktop)
 	}
 }
 
 func QueryProxySettings(desktop string, uid uint32) (*ProxyConfig, error) {
-	if err := initSession(uid); err != nil {
+	s, desktop, err := userSession(desktop, uid)
+	if err != nil {
 		return nil, err
 	}
 
 	switch desktop {
 	case "kde":
-		return queryKDESettings(false)
+		return queryKDESettings(s, false)
 	case "kde5":
-		return queryKDESettings(false)
+		return queryKDESettings(s, false)
 	case "kde6":
-		return queryKDESettings(true)
-	case "gnome":
-		return queryGnomeSettings()
+		return queryKDESettings(s, true)
+	case "gnome", "cinnamon", "mate", "budgie", "deepin":
+		return queryGnomeSettings(s, proxySchema(s, desktop))
+	case "xfce", "lxqt":
+		return queryEnvSettings(s)
+	case "networkmanager":
+		return queryNMSettings()
 	default:
 		return nil, fmt.Errorf("不支持的桌面：%s", desktop)
 	}
 }
 
-func execAsCurrentUser(name string, arg ...string) *exec.Cmd {
-	cmd := exec.Command(name, arg...)
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Credential: &syscall.Credential{
-			Uid: currentSession.uid,
-			Gid: currentSession.gid,
-		},
-	}
-	cmd.Env = append(cmd.Env,
-		fmt.Sprintf("DBUS_SESSION_BUS_ADDRESS=%s", currentSession.dbusAddr),
-		fmt.Sprintf("XDG_RUNTIME_DIR=/run/user/%d", currentSession.uid),
-		fmt.Sprintf("XDG_CONFIG_HOME=%s/.config", currentSession.homeDir),
-	)
-	return cmd
+// restoreProxy 将快照中的设置完整写回
+func restoreProxy(desktop string, uid uint32, config *ProxyConfig) error {
+	s, desktop, err := userSession(desktop, uid)
+	if err != nil {
+		return err
+	}
+
+	switch desktop {
+	case "kde", "kde5":
+		return restoreKDEProxy(s, config, false)
+	case "kde6":
+		return restoreKDEProxy(s, config, true)
+	case "gnome", "cinnamon", "mate", "budgie", "deepin":
+		return restoreGnomeProxy(s, proxySchema(s, desktop), config)
+	case "xfce", "lxqt":
+		switch {
+		case config.PAC.Enable:
+			return setEnvPac(s, config)
+		case config.Proxy.Enable:
+			return setEnvProxy(s, config)
+		}
+		return clearEnvProxy(s)
+	case "networkmanager":
+		return restoreNMProxy(config)
+	default:
+		return fmt.Errorf("不支持的桌面：%s", desktop)
+	}
 }
 
-func queryGnomeSettings() (*ProxyConfig, error) {
-	settings := map[string]string{}
-	keys := []struct {
-		name, path string
-	}{
-		{"mode", "org.gnome.system.proxy mode"},
-		{"ignore-hosts", "org.gnome.system.proxy ignore-hosts"},
-		{"autoconfig-url", "org.gnome.system.proxy autoconfig-url"},
-		{"use-same-proxy", "org.gnome.system.proxy use-same-proxy"},
-		{"http_host", "org.gnome.system.proxy.http host"},
-		{"http_port", "org.gnome.system.proxy.http port"},
-		{"https_host", "org.gnome.system.proxy.https host"},
-		{"https_port", "org.gnome.system.proxy.https port"},
-		{"ftp_host", "org.gnome.system.proxy.ftp host"},
-		{"ftp_port", "org.gnome.system.proxy.ftp port"},
-		{"socks_host", "org.gnome.system.proxy.socks host"},
-		{"socks_port", "org.gnome.system.proxy.socks port"},
+// 各桌面使用的代理 schema，按顺序选择第一个已安装的
+var proxySchemas = map[string][]string{
+	"gnome":    {"org.gnome.system.proxy"},
+	"budgie":   {"org.gnome.system.proxy"},
+	"cinnamon": {"org.cinnamon.system.proxy", "org.gnome.system.proxy"},
+	"mate":     {"org.mate.system.proxy", "org.gnome.system.proxy"},
+	"deepin":   {"com.deepin.wrap.gnome.system.proxy", "org.gnome.system.proxy"},
+}
+
+// proxySchema 返回桌面对应的代理 schema，无法列出 schema 时使用 GNOME 的兼容 schema
+func proxySchema(s *Session, desktop string) string {
+	candidates := proxySchemas[desktop]
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	output, err := s.command("gsettings", "list-schemas").Output()
+	if err == nil {
+		installed := strings.Fields(string(output))
+		for _, schema := range candidates {
+			if slices.Contains(installed, schema) {
+				return schema
+			}
+		}
 	}
+	return "org.gnome.system.proxy"
+}
 
-	for _, key := range keys {
-		output, err := execAsCurrentUser("gsettings", append([]string{"get"}, strings.Split(key.path, " ")...)...).Output()
-		if err != nil {
-			return nil, fmt.Errorf("无法读取 %s 的 GNOME 配置：%v", key.name, err)
+// GNOME 代理设置的键及 schema 中的默认值，dconf 中未设置的键使用默认值
+var gnomeProxyKeys = []struct {
+	name, schema, key string
+	fallback          any
+}{
+	{"mode", "", "mode", "none"},
+	{"ignore-hosts", "", "ignore-hosts", []string{"localhost", "127.0.0.0/8", "::1"}},
+	{"autoconfig-url", "", "autoconfig-url", ""},
+	{"use-same-proxy", "", "use-same-proxy", true},
+	{"http_host", ".http", "host", ""},
+	{"http_port", ".http", "port", int32(0)},
+	{"https_host", ".https", "host", ""},
+	{"https_port", ".https", "port", int32(0)},
+	{"ftp_host", ".ftp", "host", ""},
+	{"ftp_port", ".ftp", "port", int32(0)},
+	{"socks_host", ".socks", "host", ""},
+	{"socks_port", ".socks", "port", int32(0)},
+}
+
+func queryGnomeSettings(s *Session, schema string) (*ProxyConfig, error) {
+	settings, err := readGnomeDconf(s, schema)
+	if err != nil {
+		if settings, err = readGnomeGsettings(s, schema); err != nil {
+			return nil, err
 		}
-		settings[key.name] = string(output)
 	}
 
 	config := &ProxyConfig{}
@@ -217,7 +241,7 @@ func queryGnomeSettings() (*ProxyConfig, error) {
 		for i, item := range items {
 			items[i] = cleanOutput(item)
 		}
-		config.Proxy.Bypass = strings.Join(items, ",")
+		config.Proxy.Bypass = parseNativeBypass(items).String()
 	}
 
 	config.PAC.Enable = cleanOutput(settings["mode"]) == "auto"
@@ -226,55 +250,126 @@ func queryGnomeSettings() (*ProxyConfig, error) {
 	return config, nil
 }
 
-func setGnomeProxy(config *ProxyConfig) error {
-	if err := execGsettings("org.gnome.system.proxy", "mode", "manual"); err != nil {
-		return err
+// readGnomeDconf 从 dconf 数据库一次读取全部代理设置
+func readGnomeDconf(s *Session, schema string) (map[string]string, error) {
+	values, err := readDconf(s)
+	if err != nil {
+		return nil, err
 	}
-
-	proxyTypes := map[string]struct{ host, port string }{
-		"http":  ParseServerString(config.Proxy.Servers["http_server"]),
-		"https": ParseServerString(config.Proxy.Servers["https_server"]),
-		"ftp":   ParseServerString(config.Proxy.Servers["ftp_server"]),
-		"socks": ParseServerString(config.Proxy.Servers["socks_server"]),
+	settings := map[string]string{}
+	for _, key := range gnomeProxyKeys {
+		path, ok := dconfKeyPath(schema+key.schema, key.key)
+		if !ok {
+			return nil, fmt.Errorf("未知的 dconf 路径：%s", schema)
+		}
+		value, ok := values[path]
+		if !ok {
+			value = key.fallback
+		}
+		settings[key.name] = formatGVariant(value)
 	}
+	return settings, nil
+}
 
-	for proxyType, addr := range proxyTypes {
-		if addr.host != "" {
-			if err := execGsettings(fmt.Sprintf("org.gnome.system.proxy.%s", proxyType), "host", addr.host); err != nil {
-				return err
-			}
-			if err := execGsettings(fmt.Sprintf("org.gnome.system.proxy.%s", proxyType), "port", addr.port); err != nil {
-				return err
-			}
+func readGnomeGsettings(s *Session, schema string) (map[string]string, error) {
+	settings := map[string]string{}
+	for _, key := range gnomeProxyKeys {
+		output, err := s.command("gsettings", "get", schema+key.schema, key.key).Output()
+		if err != nil {
+			return nil, fmt.Errorf("无法读取 %s 的 GNOME 配置：%v", key.name, err)
 		}
+		settings[key.name] = string(output)
 	}
+	return settings, nil
+}
 
-	if config.Proxy.Bypass != "" {
-		bypassList := fmt.Sprintf("['%s']", strings.Join(strings.Split(config.Proxy.Bypass, ","), "','"))
-		if err := execGsettings("org.gnome.system.proxy", "ignore-hosts", bypassList); err != nil {
-			return err
-		}
+func setGnomeProxy(s *Session, schema string, config *ProxyConfig) error {
+	bypass, err := splitBypass(config.Proxy.Bypass).GNOME()
+	if err != nil {
+		return err
+	}
+	settings := []gsetting{{schema, "mode", "manual"}}
+
+	// 未指定的协议清空地址，避免沿用之前的服务器
+	for _, proxyType := range []string{"http", "https", "ftp", "socks"} {
+		addr := ParseServerString(config.Proxy.Servers[proxyType+"_server"])
+		port, _ := strconv.ParseUint(addr.port, 10, 16)
+		settings = append(settings,
+			gsetting{fmt.Sprintf("%s.%s", schema, proxyType), "host", addr.host},
+			gsetting{fmt.Sprintf("%s.%s", schema, proxyType), "port", int32(port)},
+		)
 	}
 
-	return execGsettings("org.gnome.system.proxy", "use-same-proxy", fmt.Sprintf("%v", config.Proxy.SameForAll))
+	if len(bypass) > 0 {
+		settings = append(settings, gsetting{schema, "ignore-hosts", bypass})
+	}
+
+	settings = append(settings, gsetting{schema, "use-same-proxy", config.Proxy.SameForAll})
+	return applyGsettings(s, settings)
 }
 
-func setGnomePac(config *ProxyConfig) error {
-	if err := execGsettings("org.gnome.system.proxy", "mode", "auto"); err != nil {
+func setGnomePac(s *Session, schema string, config *ProxyConfig) error {
+	return applyGsettings(s, []gsetting{
+		{schema, "mode", "auto"},
+		{schema, "autoconfig-url", config.PAC.URL},
+	})
+}
+
+func clearGnomeProxy(s *Session, schema string) error {
+	return applyGsettings(s, []gsetting{{schema, "mode", "none"}})
+}
+
+func restoreGnomeProxy(s *Session, schema string, config *ProxyConfig) error {
+	var settings []gsetting
+	for _, proxyType := range []string{"http", "https", "ftp", "socks"} {
+		addr := ParseServerString(config.Proxy.Servers[proxyType+"_server"])
+		port, _ := strconv.ParseUint(addr.port, 10, 16)
+		settings = append(settings,
+			gsetting{fmt.Sprintf("%s.%s", schema, proxyType), "host", addr.host},
+			gsetting{fmt.Sprintf("%s.%s", schema, proxyType), "port", int32(port)},
+		)
+	}
+
+	bypass, err := splitBypass(config.Proxy.Bypass).GNOME()
+	if err != nil {
 		return err
 	}
-	return execGsettings("org.gnome.system.proxy", "autoconfig-url", config.PAC.URL)
+	mode := "none"
+	switch {
+	case config.PAC.Enable:
+		mode = "auto"
+	case config.Proxy.Enable:
+		mode = "manual"
+	}
+	settings = append(settings,
+		gsetting{schema, "ignore-hosts", bypass},
+		gsetting{schema, "autoconfig-url", config.PAC.URL},
+		gsetting{schema, "use-same-proxy", config.Proxy.SameForAll},
+		gsetting{schema, "mode", mode},
+	)
+	return applyGsettings(s, settings)
 }
 
-func clearGnomeProxy() error {
-	return execGsettings("org.gnome.system.proxy", "mode", "none")
+// applyGsettings 优先通过 dconf 一次提交全部修改，不可用时逐个调用 gsettings
+func applyGsettings(s *Session, settings []gsetting) error {
+	err := writeDconf(s, settings)
+	if err == nil {
+		return nil
+	}
+	log.Printf("dconf 不可用，改用 gsettings：%v", err)
+	for _, setting := range settings {
+		if err := execGsettings(s, setting.schema, setting.key, formatGVariant(setting.value)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func execGsettings(schema, key, value string) error {
-	return execAsCurrentUser("gsettings", "set", schema, key, value).Run()
+func execGsettings(s *Session, schema, key, value string) error {
+	return s.command("gsettings", "set", schema, key, value).Run()
 }
 
-func queryKDESettings(isKde6 bool) (*ProxyConfig, error) {
+func queryKDESettings(s *Session, isKde6 bool) (*ProxyConfig, error) {
 	cmd := "kreadconfig5"
 	if isKde6 {
 		cmd = "kreadconfig6"
@@ -297,7 +392,7 @@ func queryKDESettings(isKde6 bool) (*ProxyConfig, error) {
 	}
 
 	for key := range keys {
-		output, err := execAsCurrentUser(cmd, "--file", "kioslaverc", "--group", group, "--key", key).Output()
+		output, err := s.command(cmd, "--file", "kioslaverc", "--group", group, "--key", key).Output()
 		if err != nil {
 			return nil, fmt.Errorf("无法读取 %s 的 KDE 配置：%v", key, err)
 		}
@@ -320,14 +415,14 @@ func queryKDESettings(isKde6 bool) (*ProxyConfig, error) {
 		}
 	}
 
-	config.Proxy.Bypass = keys["NoProxyFor"]
+	config.Proxy.Bypass = parseNativeBypass(strings.Split(keys["NoProxyFor"], ",")).String()
 	config.PAC.Enable = keys["ProxyType"] == "2"
 	config.PAC.URL = keys["Proxy Config Script"]
 
 	return config, nil
 }
 
-func setKDEProxy(config *ProxyConfig, isKde6 bool) error {
+func setKDEProxy(s *Session, config *ProxyConfig, isKde6 bool) error {
 	cmd := "kwriteconfig5"
 	if isKde6 {
 		cmd = "kwriteconfig6"
@@ -338,7 +433,11 @@ func setKDEProxy(config *ProxyConfig, isKde6 bool) error {
 		group = "Proxy"
 	}
 
-	if err := execKDEConfig(cmd, "ProxyType", "1", group); err != nil {
+	bypass, err := splitBypass(config.Proxy.Bypass).KDE()
+	if err != nil {
+		return err
+	}
+	if err := execKDEConfig(s, cmd, "ProxyType", "1", group); err != nil {
 		return err
 	}
 
@@ -350,12 +449,12 @@ func setKDEProxy(config *ProxyConfig, isKde6 bool) error {
 	}
 
 	for key, value := range servers {
-		if err := execKDEConfig(cmd, key, value, group); err != nil {
+		if err := execKDEConfig(s, cmd, key, value, group); err != nil {
 			return err
 		}
 	}
 
-	if err := execKDEConfig(cmd, "NoProxyFor", config.Proxy.Bypass, group); err != nil {
+	if err := execKDEConfig(s, cmd, "NoProxyFor", bypass, group); err != nil {
 		return err
 	}
 
@@ -363,10 +462,10 @@ func setKDEProxy(config *ProxyConfig, isKde6 bool) error {
 	if config.Proxy.SameForAll {
 		sameProxy = "true"
 	}
-	return execKDEConfig(cmd, "UseSameProxy", sameProxy, group)
+	return execKDEConfig(s, cmd, "UseSameProxy", sameProxy, group)
 }
 
-func setKDEPac(config *ProxyConfig, isKde6 bool) error {
+func setKDEPac(s *Session, config *ProxyConfig, isKde6 bool) error {
 	cmd := "kwriteconfig5"
 	if isKde6 {
 		cmd = "kwriteconfig6"
@@ -377,14 +476,14 @@ func setKDEPac(config *ProxyConfig, isKde6 bool) error {
 		group = "Proxy"
 	}
 
-	if err := execKDEConfig(cmd, "ProxyType", "2", group); err != nil {
+	if err := execKDEConfig(s, cmd, "ProxyType", "2", group); err != nil {
 		return err
 	}
 
-	return execKDEConfig(cmd, "Proxy Config Script", config.PAC.URL, group)
+	return execKDEConfig(s, cmd, "Proxy Config Script", config.PAC.URL, group)
 }
 
-func clearKDEProxy(isKde6 bool) error {
+func clearKDEProxy(s *Session, isKde6 bool) error {
 	cmd := "kwriteconfig5"
 	if isKde6 {
 		cmd = "kwriteconfig6"
@@ -395,10 +494,55 @@ func clearKDEProxy(isKde6 bool) error {
 		group = "Proxy"
 	}
 
-	return execKDEConfig(cmd, "ProxyType", "0", group)
+	return execKDEConfig(s, cmd, "ProxyType", "0", group)
+}
+
+func restoreKDEProxy(s *Session, config *ProxyConfig, isKde6 bool) error {
+	cmd := "kwriteconfig5"
+	if isKde6 {
+		cmd = "kwriteconfig6"
+	}
+
+	group := "Proxy Settings"
+	if !isKde6 {
+		group = "Proxy"
+	}
+
+	proxyType := "0"
+	switch {
+	case config.PAC.Enable:
+		proxyType = "2"
+	case config.Proxy.Enable:
+		proxyType = "1"
+	}
+	sameProxy := "false"
+	if config.Proxy.SameForAll {
+		sameProxy = "true"
+	}
+	bypass, err := splitBypass(config.Proxy.Bypass).KDE()
+	if err != nil {
+		return err
+	}
+
+	keys := [][2]string{
+		{"httpProxy", config.Proxy.Servers["http_server"]},
+		{"httpsProxy", config.Proxy.Servers["https_server"]},
+		{"socksProxy", config.Proxy.Servers["socks_server"]},
+		{"ftpProxy", config.Proxy.Servers["ftp_server"]},
+		{"NoProxyFor", bypass},
+		{"Proxy Config Script", config.PAC.URL},
+		{"UseSameProxy", sameProxy},
+		{"ProxyType", proxyType},
+	}
+	for _, key := range keys {
+		if err := execKDEConfig(s, cmd, key[0], key[1], group); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func execKDEConfig(cmd, key, value, group string) error {
+func execKDEConfig(s *Session, cmd, key, value, group string) error {
 	args := []string{"--file", "kioslaverc", "--group", group, "--key", key, value}
-	return execAsCurrentUser(cmd, args...).Run()
+	return s.command(cmd, args...).Run()
 }
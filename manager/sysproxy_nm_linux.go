@@ -0,0 +1,197 @@
+//go:build linux
+
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sparkle-service/config"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// NetworkManager 的连接代理只支持关闭与自动两种方式，手动代理通过生成的 PAC 脚本实现。
+// 默认修改所有活动连接，配置了连接名称时只修改指定的连接
+const (
+	nmService      = "org.freedesktop.NetworkManager"
+	nmPath         = "/org/freedesktop/NetworkManager"
+	nmSettingsPath = "/org/freedesktop/NetworkManager/Settings"
+
+	nmProxyNone = int32(0)
+	nmProxyAuto = int32(1)
+)
+
+// nmSecretSettings 为可能包含密钥的设置，更新连接时需要一并提交，否则密钥会丢失
+var nmSecretSettings = []string{"802-11-wireless-security", "802-1x", "vpn", "wireguard", "pppoe", "gsm", "cdma"}
+
+type nmSettings map[string]map[string]dbus.Variant
+
+type nmConnection struct {
+	path     dbus.ObjectPath
+	id       string
+	settings nmSettings
+	// devices 为连接处于活动状态时使用的设备，用于立即应用新的设置
+	devices []dbus.ObjectPath
+}
+
+// nmConnections 返回需要修改代理设置的连接
+func nmConnections(conn *dbus.Conn) ([]*nmConnection, error) {
+	variant, err := conn.Object(nmService, nmPath).GetProperty(nmService + ".ActiveConnections")
+	if err != nil {
+		return nil, fmt.Errorf("无法连接 NetworkManager：%v", err)
+	}
+	actives, _ := variant.Value().([]dbus.ObjectPath)
+
+	devices := map[dbus.ObjectPath][]dbus.ObjectPath{}
+	var paths []dbus.ObjectPath
+	for _, active := range actives {
+		obj := conn.Object(nmService, active)
+		variant, err := obj.GetProperty(nmService + ".Connection.Active.Connection")
+		if err != nil {
+			continue
+		}
+		path, _ := variant.Value().(dbus.ObjectPath)
+		if variant, err := obj.GetProperty(nmService + ".Connection.Active.Devices"); err == nil {
+			devices[path], _ = variant.Value().([]dbus.ObjectPath)
+		}
+		if variant, err := obj.GetProperty(nmService + ".Connection.Active.Type"); err == nil && variant.Value() == "loopback" {
+			continue
+		}
+		paths = append(paths, path)
+	}
+
+	names := config.GetSysproxyConnections()
+	if len(names) > 0 {
+		if err := conn.Object(nmService, nmSettingsPath).Call(nmService+".Settings.ListConnections", 0).Store(&paths); err != nil {
+			return nil, fmt.Errorf("无法读取网络连接：%v", err)
+		}
+	}
+
+	var connections []*nmConnection
+	for _, path := range paths {
+		var settings nmSettings
+		if err := conn.Object(nmService, path).Call(nmService+".Settings.Connection.GetSettings", 0).Store(&settings); err != nil {
+			return nil, fmt.Errorf("无法读取网络连接：%v", err)
+		}
+		id, _ := settings["connection"]["id"].Value().(string)
+		if len(names) > 0 && !slices.Contains(names, id) {
+			continue
+		}
+		connections = append(connections, &nmConnection{path: path, id: id, settings: settings, devices: devices[path]})
+	}
+
+	for _, name := range names {
+		if !slices.ContainsFunc(connections, func(c *nmConnection) bool { return c.id == name }) {
+			return nil, fmt.Errorf("未找到网络连接：%s", name)
+		}
+	}
+	if len(connections) == 0 {
+		return nil, fmt.Errorf("没有活动的网络连接")
+	}
+	return connections, nil
+}
+
+// updateNMProxy 替换连接的代理设置并重新应用到正在使用的设备
+func updateNMProxy(proxy map[string]dbus.Variant) error {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return fmt.Errorf("无法连接系统总线：%v", err)
+	}
+	defer conn.Close()
+
+	connections, err := nmConnections(conn)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, c := range connections {
+		obj := conn.Object(nmService, c.path)
+		for _, name := range nmSecretSettings {
+			if _, ok := c.settings[name]; !ok {
+				continue
+			}
+			var secrets nmSettings
+			if err := obj.Call(nmService+".Settings.Connection.GetSecrets", 0, name).Store(&secrets); err != nil {
+				continue
+			}
+			for key, value := range secrets[name] {
+				c.settings[name][key] = value
+			}
+		}
+
+		c.settings["proxy"] = proxy
+		if err := obj.Call(nmService+".Settings.Connection.Update", 0, c.settings).Err; err != nil {
+			errs = append(errs, fmt.Errorf("更新网络连接 %s 失败：%v", c.id, err))
+			continue
+		}
+		for _, device := range c.devices {
+			// 无法重新应用时新的设置在下次连接时生效
+			_ = conn.Object(nmService, device).Call(nmService+".Device.Reapply", 0, nmSettings{}, uint64(0), uint32(0)).Err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setNMProxy(config *ProxyConfig) error {
+	script, err := generatePac(config)
+	if err != nil {
+		return err
+	}
+	return updateNMProxy(map[string]dbus.Variant{
+		"method":     dbus.MakeVariant(nmProxyAuto),
+		"pac-script": dbus.MakeVariant(script),
+	})
+}
+
+func setNMPac(config *ProxyConfig) error {
+	return updateNMProxy(map[string]dbus.Variant{
+		"method":  dbus.MakeVariant(nmProxyAuto),
+		"pac-url": dbus.MakeVariant(config.PAC.URL),
+	})
+}
+
+func clearNMProxy() error {
+	return updateNMProxy(map[string]dbus.Variant{
+		"method": dbus.MakeVariant(nmProxyNone),
+	})
+}
+
+// queryNMSettings 读取第一个连接的代理设置，自动方式下未设置 PAC 地址时为 WPAD
+func queryNMSettings() (*ProxyConfig, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("无法连接系统总线：%v", err)
+	}
+	defer conn.Close()
+
+	connections, err := nmConnections(conn)
+	if err != nil {
+		return nil, err
+	}
+	proxy := connections[0].settings["proxy"]
+
+	config := &ProxyConfig{}
+	config.Proxy.Servers = map[string]string{}
+	if method, _ := proxy["method"].Value().(int32); method != nmProxyAuto {
+		return config, nil
+	}
+	script, _ := proxy["pac-script"].Value().(string)
+	if parsed, ok := parsePac(script); ok {
+		return parsed, nil
+	}
+	config.PAC.Enable = true
+	config.PAC.URL, _ = proxy["pac-url"].Value().(string)
+	return config, nil
+}
+
+func restoreNMProxy(config *ProxyConfig) error {
+	switch {
+	case config.PAC.Enable:
+		return setNMPac(config)
+	case config.Proxy.Enable:
+		return setNMProxy(config)
+	}
+	return clearNMProxy()
+}
@@ -4,18 +4,26 @@ package manager
 
 import "fmt"
 
-func DisableProxy(_ string, _ uint32) error {
+func disableSystemProxy(_ string, _ uint32) error {
 	return fmt.Errorf("不支持的操作系统")
 }
 
-func SetProxy(_, _, _ string, _ uint32) error {
+func setSystemProxy(_ *ProxyConfig, _ string, _ uint32) error {
 	return fmt.Errorf("不支持的操作系统")
 }
 
-func SetPac(_, _ string, _ uint32) error {
+func setSystemPac(_, _ string, _ uint32) error {
 	return fmt.Errorf("不支持的操作系统")
 }
 
-func QueryProxySettings(_ string, _ uint32) (map[string]any, error) {
+func QueryProxySettings(_ string, _ uint32) (*ProxyConfig, error) {
 	return nil, fmt.Errorf("不支持的操作系统")
 }
+
+func proxyBackend(_ string, _ uint32) (string, error) {
+	return "", fmt.Errorf("不支持的操作系统")
+}
+
+func restoreProxy(_ string, _ uint32, _ *ProxyConfig) error {
+	return fmt.Errorf("不支持的操作系统")
+}
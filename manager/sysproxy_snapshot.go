@@ -0,0 +1,155 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sparkle-service/config"
+	"time"
+
+	"github.com/metacubex/bbolt"
+)
+
+const (
+	proxySnapshotBucket = "sysproxy-snapshot"
+	// proxyTargetBucket 按用户记录写入过代理的命令行代理目标
+	proxyTargetBucket = "sysproxy-targets"
+)
+
+// proxySnapshot 为首次修改前用户原有的代理设置
+type proxySnapshot struct {
+	Backend string       `json:"backend"`
+	UID     uint32       `json:"uid"`
+	Config  *ProxyConfig `json:"config"`
+	SavedAt time.Time    `json:"saved_at"`
+}
+
+func proxySnapshotKey(backend string, uid uint32) []byte {
+	return []byte(fmt.Sprintf("%s/%d", backend, uid))
+}
+
+func proxyTargetKey(uid uint32) []byte {
+	return []byte(fmt.Sprint(uid))
+}
+
+// saveProxySnapshot 在尚无快照时保存当前代理设置，之后的修改不再覆盖快照
+func saveProxySnapshot(backend string, uid uint32, query func() (*ProxyConfig, error)) error {
+	if snapshot, err := loadProxySnapshot(backend, uid); err != nil || snapshot != nil {
+		return err
+	}
+	current, err := query()
+	if err != nil {
+		return fmt.Errorf("无法保存原有代理设置：%w", err)
+	}
+	data, err := json.Marshal(proxySnapshot{
+		Backend: backend,
+		UID:     uid,
+		Config:  current,
+		SavedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	db, err := openCacheDB()
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(proxySnapshotBucket)).Put(proxySnapshotKey(backend, uid), data)
+	})
+}
+
+// snapshotBeforeChange 在修改任何后端之前保存全部后端的快照，
+// 无法保存时不修改代理，避免之后无法恢复用户原有的设置
+func snapshotBeforeChange(backends []string, uid uint32) error {
+	for _, backend := range backends {
+		err := saveProxySnapshot(backend, uid, func() (*ProxyConfig, error) {
+			return QueryProxySettings(backend, uid)
+		})
+		if err != nil {
+			return fmt.Errorf("保存 %s 的代理设置快照失败：%w", backend, err)
+		}
+	}
+	return nil
+}
+
+func loadProxySnapshot(backend string, uid uint32) (*proxySnapshot, error) {
+	db, err := openCacheDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot *proxySnapshot
+	err = db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte(proxySnapshotBucket)).Get(proxySnapshotKey(backend, uid))
+		if data == nil {
+			return nil
+		}
+		snapshot = &proxySnapshot{}
+		return json.Unmarshal(data, snapshot)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取代理设置快照失败：%w", err)
+	}
+	return snapshot, nil
+}
+
+func deleteProxySnapshot(backend string, uid uint32) error {
+	db, err := openCacheDB()
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(proxySnapshotBucket)).Delete(proxySnapshotKey(backend, uid))
+	})
+}
+
+// RestoreProxy 恢复首次修改前的代理设置并删除快照
+func RestoreProxy(desktop string, uid uint32) error {
+	backends, err := proxyBackends(desktop, uid)
+	if err != nil {
+		return err
+	}
+	restored := false
+	for _, backend := range backends {
+		snapshot, err := loadProxySnapshot(backend, uid)
+		if err != nil {
+			return err
+		}
+		if snapshot == nil {
+			continue
+		}
+		if !restored {
+			proxyGuard(uid).untrack()
+			if err := applyProxyTargets(uid, nil); err != nil {
+				return err
+			}
+			restored = true
+		}
+		if err := restoreProxy(backend, uid, snapshot.Config); err != nil {
+			return fmt.Errorf("恢复代理设置失败：%w", err)
+		}
+		if err := deleteProxySnapshot(backend, uid); err != nil {
+			return err
+		}
+	}
+	if !restored {
+		return fmt.Errorf("没有可恢复的代理设置")
+	}
+	return nil
+}
+
+// restoreOnDisable 在启用 restore-on-disable 且存在快照时恢复原有设置，返回是否已处理
+func restoreOnDisable(backend string, uid uint32) (bool, error) {
+	if !config.GetRestoreOnDisable() {
+		return false, nil
+	}
+	snapshot, err := loadProxySnapshot(backend, uid)
+	if err != nil || snapshot == nil {
+		return false, err
+	}
+	if err := restoreProxy(backend, uid, snapshot.Config); err != nil {
+		return true, fmt.Errorf("恢复代理设置失败：%w", err)
+	}
+	return true, deleteProxySnapshot(backend, uid)
+}
@@ -0,0 +1,354 @@
+//go:build linux
+
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sparkle-service/config"
+	"strings"
+
+	"github.com/metacubex/bbolt"
+)
+
+// 命令行工具不读取桌面代理设置，按需将代理写入各工具的配置文件。
+// 写入的内容位于标记行之间，关闭代理时只删除标记内的部分
+const (
+	managedBegin = ">>> sparkle proxy >>>"
+	managedEnd   = "<<< sparkle proxy <<<"
+
+	aptProxyFile = "/etc/apt/apt.conf.d/95sparkle-proxy"
+	dnfConfFile  = "/etc/dnf/dnf.conf"
+)
+
+// proxyTargets 为可单独启用的代理目标，apt、dnf 与容器守护进程为系统级设置
+var proxyTargets = []string{
+	"environment", "bash", "zsh", "fish", "git", "npm", "pip", "apt", "dnf", "docker", "containerd", "podman",
+}
+
+// systemTargets 只修改系统配置，不需要用户会话
+var systemTargets = []string{"apt", "dnf", "containerd"}
+
+// SetProxyTargets 设置启用的命令行代理目标
+func SetProxyTargets(targets []string) error {
+	for _, target := range targets {
+		if !slices.Contains(proxyTargets, target) {
+			return fmt.Errorf("不支持的代理目标：%s", target)
+		}
+	}
+	return config.UpdateSysproxyTargets(targets)
+}
+
+// ProxyTargetStatus 返回各代理目标是否启用，以及守护进程是否需要重启才能使用新的代理
+func ProxyTargetStatus() []TargetStatus {
+	enabled := config.GetSysproxyTargets()
+	list := make([]TargetStatus, 0, len(proxyTargets))
+	for _, target := range proxyTargets {
+		status := TargetStatus{Name: target, Enabled: slices.Contains(enabled, target)}
+		if unit, ok := proxyServices[target]; ok {
+			status.Service = unit
+			status.RestartRequired = serviceRestartRequired(unit)
+		}
+		list = append(list, status)
+	}
+	return list
+}
+
+// applyProxyTargets 将代理写入启用的目标，并删除之前写入但已不再启用的目标，
+// proxy 为空时只删除由服务写入过的目标。写入过的目标按用户记录，未写入过的目标不做修改
+func applyProxyTargets(uid uint32, proxy *ProxyConfig) error {
+	applied, err := loadAppliedTargets(uid)
+	if err != nil {
+		return err
+	}
+	var enabled []string
+	if proxy != nil {
+		enabled = config.GetSysproxyTargets()
+	}
+	if len(enabled) == 0 && len(applied) == 0 {
+		return nil
+	}
+
+	var env map[string]string
+	if len(enabled) > 0 {
+		if env, err = proxyEnv(proxy); err != nil {
+			return err
+		}
+	}
+
+	// 只涉及系统级目标时不查找用户会话，未登录时仍可修改
+	var (
+		s          *Session
+		sessionErr error
+	)
+	for _, target := range append(slices.Clone(enabled), applied...) {
+		if !slices.Contains(systemTargets, target) {
+			s, sessionErr = getSession(uid)
+			break
+		}
+	}
+
+	var (
+		errs    []error
+		written []string
+	)
+	for _, target := range proxyTargets {
+		write := slices.Contains(enabled, target)
+		if !write && !slices.Contains(applied, target) {
+			continue
+		}
+		err := sessionErr
+		if err == nil || slices.Contains(systemTargets, target) {
+			if write {
+				err = writeProxyTarget(s, target, env)
+			} else {
+				err = writeProxyTarget(s, target, nil)
+			}
+		}
+		// 写入失败时可能已写入部分内容，与删除失败的目标一样保留记录，之后再次删除
+		if write || err != nil {
+			written = append(written, target)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("设置 %s 代理失败：%w", target, err))
+		}
+	}
+	if err := saveAppliedTargets(uid, written); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func loadAppliedTargets(uid uint32) ([]string, error) {
+	db, err := openCacheDB()
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	err = db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte(proxyTargetBucket)).Get(proxyTargetKey(uid))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &targets)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取已写入的代理目标失败：%w", err)
+	}
+	return targets, nil
+}
+
+func saveAppliedTargets(uid uint32, targets []string) error {
+	db, err := openCacheDB()
+	if err != nil {
+		return err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(proxyTargetBucket))
+		if len(targets) == 0 {
+			return bucket.Delete(proxyTargetKey(uid))
+		}
+		data, err := json.Marshal(targets)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(proxyTargetKey(uid), data)
+	})
+	if err != nil {
+		return fmt.Errorf("记录已写入的代理目标失败：%w", err)
+	}
+	return nil
+}
+
+// writeProxyTarget 按目标的配置格式写入代理，env 为空时删除
+func writeProxyTarget(s *Session, target string, env map[string]string) error {
+	httpProxy := firstHTTPProxy(env["http_proxy"], env["all_proxy"])
+	httpsProxy := firstHTTPProxy(env["https_proxy"], httpProxy)
+
+	switch target {
+	case "environment":
+		return writeEnvProxy(s, env)
+	case "bash":
+		return updateUserBlock(s, filepath.Join(s.homeDir, ".bashrc"), "#", "", shellExports(env, false))
+	case "zsh":
+		return updateUserBlock(s, filepath.Join(s.homeDir, ".zshrc"), "#", "", shellExports(env, false))
+	case "fish":
+		return updateUserBlock(s, filepath.Join(s.homeDir, ".config/fish/config.fish"), "#", "", shellExports(env, true))
+	case "git":
+		var lines []string
+		if httpProxy != "" {
+			lines = []string{"[http]", "\tproxy = " + httpProxy}
+		}
+		return updateUserBlock(s, filepath.Join(s.homeDir, ".gitconfig"), "#", "", lines)
+	case "npm":
+		var npm, yarn []string
+		if httpProxy != "" {
+			npm = append(npm, "proxy="+httpProxy, "https-proxy="+httpsProxy)
+			yarn = append(yarn, fmt.Sprintf("proxy %q", httpProxy), fmt.Sprintf("https-proxy %q", httpsProxy))
+		}
+		if bypass := env["no_proxy"]; bypass != "" && npm != nil {
+			npm = append(npm, "noproxy="+bypass)
+		}
+		if err := updateUserBlock(s, filepath.Join(s.homeDir, ".npmrc"), "#", "", npm); err != nil {
+			return err
+		}
+		// yarn 1.x 同时读取 .npmrc 与 .yarnrc
+		return updateUserBlock(s, filepath.Join(s.homeDir, ".yarnrc"), "#", "", yarn)
+	case "pip":
+		var lines []string
+		if httpsProxy != "" {
+			lines = []string{"proxy = " + httpsProxy}
+		}
+		return updateUserBlock(s, filepath.Join(s.homeDir, ".config/pip/pip.conf"), "#", "global", lines)
+	case "apt":
+		var lines []string
+		for _, scheme := range []string{"http", "https", "ftp"} {
+			if value := firstHTTPProxy(env[scheme+"_proxy"], httpProxy); value != "" {
+				lines = append(lines, fmt.Sprintf("Acquire::%s::Proxy %q;", scheme, value))
+			}
+		}
+		return updateSystemBlock(aptProxyFile, "//", "", lines)
+	case "dnf":
+		var lines []string
+		if httpProxy != "" {
+			lines = []string{"proxy=" + httpProxy}
+		}
+		return updateSystemBlock(dnfConfFile, "#", "main", lines)
+	case "docker":
+		if err := writeServiceProxy(proxyServices[target], serviceProxyEnv(env)); err != nil {
+			return err
+		}
+		return writeDockerClientProxy(s, env)
+	case "containerd":
+		return writeServiceProxy(proxyServices[target], serviceProxyEnv(env))
+	case "podman":
+		return updateUserBlock(s, filepath.Join(s.homeDir, podmanConfFile), "#", "engine", podmanEngineEnv(env))
+	default:
+		return fmt.Errorf("不支持的代理目标：%s", target)
+	}
+}
+
+// firstHTTPProxy 返回第一个非空的 HTTP 代理地址，apt、pip 等工具不支持 SOCKS 代理
+func firstHTTPProxy(values ...string) string {
+	for _, value := range values {
+		if strings.HasPrefix(value, "http://") {
+			return value
+		}
+	}
+	return ""
+}
+
+// shellExports 生成导出代理环境变量的 shell 语句
+func shellExports(env map[string]string, fish bool) []string {
+	var lines []string
+	for _, key := range envProxyKeys {
+		value, ok := env[key]
+		if !ok {
+			continue
+		}
+		for _, name := range []string{key, strings.ToUpper(key)} {
+			if fish {
+				quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+				lines = append(lines, fmt.Sprintf("set -gx %s '%s'", name, quoted))
+			} else {
+				quoted := strings.ReplaceAll(value, `'`, `'\''`)
+				lines = append(lines, fmt.Sprintf("export %s='%s'", name, quoted))
+			}
+		}
+	}
+	return lines
+}
+
+// updateUserBlock 以用户身份更新文件中的受管理内容，文件只剩受管理内容时删除文件
+func updateUserBlock(s *Session, path, comment, section string, lines []string) error {
+	data, err := readUserFile(s, path)
+	if err != nil {
+		return err
+	}
+	result := replaceManagedBlock(data, comment, section, lines)
+	switch {
+	case bytes.Equal(result, data):
+		return nil
+	case len(result) == 0:
+		return removeUserFile(s, path)
+	}
+	return writeUserFile(s, path, result)
+}
+
+// updateSystemBlock 更新系统配置文件中的受管理内容，对应的工具未安装时跳过删除
+func updateSystemBlock(path, comment, section string, lines []string) error {
+	if _, err := os.Stat(filepath.Dir(path)); err != nil {
+		if len(lines) == 0 {
+			return nil
+		}
+		return fmt.Errorf("未找到 %s：%v", filepath.Dir(path), err)
+	}
+
+	mode := os.FileMode(0644)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	result := replaceManagedBlock(data, comment, section, lines)
+	switch {
+	case bytes.Equal(result, data):
+		return nil
+	case len(result) == 0:
+		return os.Remove(path)
+	}
+	return os.WriteFile(path, result, mode)
+}
+
+// replaceManagedBlock 替换标记行之间的内容，lines 为空时只删除原有内容。
+// section 不为空时内容写入该 ini 节，文件中没有该节时连同节名一起追加到末尾
+func replaceManagedBlock(data []byte, comment, section string, lines []string) []byte {
+	begin, end := comment+" "+managedBegin, comment+" "+managedEnd
+
+	var kept []string
+	if text := strings.TrimSuffix(string(data), "\n"); text != "" {
+		inBlock := false
+		for _, line := range strings.Split(text, "\n") {
+			switch strings.TrimSpace(line) {
+			case begin:
+				inBlock = true
+				continue
+			case end:
+				inBlock = false
+				continue
+			}
+			if !inBlock {
+				kept = append(kept, line)
+			}
+		}
+	}
+
+	if len(lines) > 0 {
+		block := []string{begin, comment + " 由 Sparkle 管理，请勿手动修改"}
+		insert := len(kept)
+		if section != "" {
+			index := slices.IndexFunc(kept, func(line string) bool {
+				return strings.TrimSpace(line) == "["+section+"]"
+			})
+			if index >= 0 {
+				insert = index + 1
+			} else {
+				block = append(block, "["+section+"]")
+			}
+		}
+		block = append(append(block, lines...), end)
+		kept = slices.Insert(kept, insert, block...)
+	}
+
+	if len(kept) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(kept, "\n") + "\n")
+}
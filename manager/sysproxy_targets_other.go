@@ -0,0 +1,24 @@
+//go:build !linux
+
+package manager
+
+import (
+	"fmt"
+	"sparkle-service/config"
+)
+
+// SetProxyTargets 其他平台的命令行工具读取系统代理设置，不支持单独的代理目标
+func SetProxyTargets(targets []string) error {
+	if len(targets) > 0 {
+		return fmt.Errorf("不支持的操作系统")
+	}
+	return config.UpdateSysproxyTargets(targets)
+}
+
+func ProxyTargetStatus() []TargetStatus {
+	return []TargetStatus{}
+}
+
+func applyProxyTargets(_ uint32, _ *ProxyConfig) error {
+	return nil
+}
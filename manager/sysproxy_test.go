@@ -0,0 +1,44 @@
+package manager
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 某个后端失败时继续修改其余后端，并守护修改成功的后端
+func TestApplyBackendsPartialFailure(t *testing.T) {
+	const uid = 1003
+	defer func() {
+		guardsMutex.Lock()
+		delete(proxyGuards, uid)
+		guardsMutex.Unlock()
+	}()
+
+	var called []string
+	applied, err := applyBackends([]string{"gnome", "kde", "networkmanager"}, uid, func(backend string) error {
+		called = append(called, backend)
+		if backend == "kde" {
+			return errors.New("写入失败")
+		}
+		return nil
+	})
+	if want := []string{"gnome", "kde", "networkmanager"}; !reflect.DeepEqual(called, want) {
+		t.Errorf("applyBackends() 修改了 %v, want %v", called, want)
+	}
+	if want := []string{"gnome", "networkmanager"}; !reflect.DeepEqual(applied, want) {
+		t.Errorf("applyBackends() applied = %v, want %v", applied, want)
+	}
+	if err == nil || !strings.Contains(err.Error(), "kde：写入失败") {
+		t.Errorf("applyBackends() error = %v, want kde：写入失败", err)
+	}
+
+	g := proxyGuard(uid)
+	g.mutex.Lock()
+	tracked, backends := g.tracked, g.backends
+	g.mutex.Unlock()
+	if !tracked || !reflect.DeepEqual(backends, applied) {
+		t.Errorf("守护的后端 = %v, %v, want %v", tracked, backends, applied)
+	}
+}
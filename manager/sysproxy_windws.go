@@ -4,6 +4,7 @@ package manager
 
 import (
 	"fmt"
+	"strings"
 	"syscall"
 	"unsafe"
 )
@@ -64,28 +65,26 @@ func refreshAndApplySettings(options []InternetPerConnOption) error {
 	return nil
 }
 
-func DisableProxy(_ string, _ uint32) error {
+// Windows 的代理设置通过 WinINet 管理
+const windowsProxyBackend = "wininet"
+
+func proxyBackend(_ string, _ uint32) (string, error) {
+	return windowsProxyBackend, nil
+}
+
+func disableSystemProxy(_ string, _ uint32) error {
 	return refreshAndApplySettings([]InternetPerConnOption{{
 		dwOption: INTERNET_PER_CONN_FLAGS,
 		dwValue:  PROXY_TYPE_DIRECT,
 	}})
 }
 
-func SetProxy(proxy, bypass, _ string, _ uint32) error {
-	if proxy == "" || bypass == "" {
-		config, err := QueryProxySettings("", 0)
-		if err != nil {
-			return err
-		}
-
-		if proxy == "" {
-			proxy = config.Proxy.Servers["http_server"]
-		}
-		if bypass == "" {
-			bypass = config.Proxy.Bypass
-		}
+func setSystemProxy(config *ProxyConfig, _ string, _ uint32) error {
+	proxyPtr, err := syscall.UTF16PtrFromString(formatWininetServers(config))
+	if err != nil {
+		return err
 	}
-	proxyPtr, err := syscall.UTF16PtrFromString(proxy)
+	bypass, err := splitBypass(config.Proxy.Bypass).Windows()
 	if err != nil {
 		return err
 	}
@@ -101,7 +100,7 @@ func SetProxy(proxy, bypass, _ string, _ uint32) error {
 	})
 }
 
-func SetPac(pacUrl, _ string, _ uint32) error {
+func setSystemPac(pacUrl, _ string, _ uint32) error {
 	if pacUrl == "" {
 		return refreshAndApplySettings([]InternetPerConnOption{
 			{dwOption: INTERNET_PER_CONN_FLAGS, dwValue: PROXY_TYPE_AUTO_PROXY_URL},
@@ -144,16 +143,87 @@ func QueryProxySettings(_ string, _ uint32) (*ProxyConfig, error) {
 	config := &ProxyConfig{}
 
 	config.Proxy.Enable = (flags & PROXY_TYPE_PROXY) != 0
-	config.Proxy.Servers = map[string]string{
-		"http_server": getString(options[1].dwValue),
-	}
-	config.Proxy.Bypass = getString(options[2].dwValue)
+	config.Proxy.Servers, config.Proxy.SameForAll = parseWininetServers(getString(options[1].dwValue))
+	config.Proxy.Bypass = parseNativeBypass(strings.Split(getString(options[2].dwValue), ";")).String()
 	config.PAC.Enable = (flags & PROXY_TYPE_AUTO_PROXY_URL) != 0
 	config.PAC.URL = getString(options[3].dwValue)
 
 	return config, nil
 }
 
+// restoreProxy 将快照中的设置完整写回
+func restoreProxy(_ string, _ uint32, config *ProxyConfig) error {
+	flags := uintptr(PROXY_TYPE_DIRECT)
+	if config.Proxy.Enable {
+		flags |= PROXY_TYPE_PROXY
+	}
+	if config.PAC.Enable {
+		flags |= PROXY_TYPE_AUTO_PROXY_URL
+	}
+
+	proxyPtr, err := syscall.UTF16PtrFromString(formatWininetServers(config))
+	if err != nil {
+		return err
+	}
+	bypass, err := splitBypass(config.Proxy.Bypass).Windows()
+	if err != nil {
+		return err
+	}
+	bypassPtr, err := syscall.UTF16PtrFromString(bypass)
+	if err != nil {
+		return err
+	}
+	pacPtr, err := syscall.UTF16PtrFromString(config.PAC.URL)
+	if err != nil {
+		return err
+	}
+
+	return refreshAndApplySettings([]InternetPerConnOption{
+		{dwOption: INTERNET_PER_CONN_FLAGS, dwValue: flags},
+		{dwOption: INTERNET_PER_CONN_PROXY_SERVER, dwValue: uintptr(unsafe.Pointer(proxyPtr))},
+		{dwOption: INTERNET_PER_CONN_PROXY_BYPASS, dwValue: uintptr(unsafe.Pointer(bypassPtr))},
+		{dwOption: INTERNET_PER_CONN_AUTOCONFIG_URL, dwValue: uintptr(unsafe.Pointer(pacPtr))},
+	})
+}
+
+// WinINet 中单个地址用于所有协议，分协议时写成 http=host:port;https=host:port
+var wininetSchemes = []struct{ scheme, key string }{
+	{"http", "http_server"},
+	{"https", "https_server"},
+	{"ftp", "ftp_server"},
+	{"socks", "socks_server"},
+}
+
+func formatWininetServers(config *ProxyConfig) string {
+	if config.Proxy.SameForAll {
+		return config.Proxy.Servers["http_server"]
+	}
+	var parts []string
+	for _, s := range wininetSchemes {
+		if server := config.Proxy.Servers[s.key]; server != "" {
+			parts = append(parts, s.scheme+"="+server)
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+func parseWininetServers(value string) (map[string]string, bool) {
+	servers := map[string]string{}
+	if !strings.Contains(value, "=") {
+		for _, s := range wininetSchemes {
+			servers[s.key] = value
+		}
+		return servers, true
+	}
+	for _, part := range strings.Split(value, ";") {
+		scheme, server, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			servers[strings.ToLower(scheme)+"_server"] = server
+		}
+	}
+	return servers, false
+}
+
 func getString(val uintptr) string {
 	if val == 0 {
 		return ""
@@ -0,0 +1,138 @@
+# 生成 dconf 测试数据：值与变更集由 GLib 序列化，数据库按 gvdb-builder 的布局写出
+import ctypes, struct, sys
+g = ctypes.CDLL("libglib-2.0.so.0")
+gio = ctypes.CDLL("libgio-2.0.so.0")
+vp = ctypes.c_void_p
+g.g_variant_parse.restype = vp
+g.g_variant_parse.argtypes = [vp, ctypes.c_char_p, vp, vp, vp]
+g.g_variant_type_new.restype = vp
+g.g_variant_type_new.argtypes = [ctypes.c_char_p]
+g.g_variant_new_variant.restype = vp
+g.g_variant_new_variant.argtypes = [vp]
+g.g_variant_get_size.restype = ctypes.c_size_t
+g.g_variant_get_size.argtypes = [vp]
+g.g_variant_get_data.restype = vp
+g.g_variant_get_data.argtypes = [vp]
+
+def parse(t, text):
+    v = g.g_variant_parse(g.g_variant_type_new(t.encode()) if t else None, text.encode(), None, None, None)
+    assert v, text
+    return v
+
+def data(v):
+    return ctypes.string_at(g.g_variant_get_data(v), g.g_variant_get_size(v))
+
+out = sys.argv[1]
+
+values = [
+    ("/system/proxy/mode", "'manual'"),
+    ("/system/proxy/use-same-proxy", "false"),
+    ("/system/proxy/ignore-hosts", "['localhost', '127.0.0.0/8', '::1']"),
+    ("/system/proxy/autoconfig-url", "''"),
+    ("/system/proxy/http/host", "'127.0.0.1'"),
+    ("/system/proxy/http/port", "7890"),
+    ("/system/proxy/https/host", "'127.0.0.1'"),
+    ("/system/proxy/https/port", "7890"),
+    ("/system/proxy/socks/host", "'127.0.0.1'"),
+    ("/system/proxy/socks/port", "7891"),
+    ("/org/gnome/desktop/interface/color-scheme", "'prefer-dark'"),
+    ("/org/gnome/desktop/input-sources/xkb-options", "@as []"),
+    ("/org/gnome/desktop/session/idle-delay", "uint32 300"),
+]
+
+# gvdb 条目：目录为 L，值为 v
+items = {}
+def add(key, value=None):
+    if key in items:
+        return
+    parent = None
+    if key != "/":
+        parent = key[:key.rstrip("/").rfind("/") + 1]
+        add(parent)
+        items[parent]["children"].append(key)
+    items[key] = {"value": value, "children": [], "parent": parent}
+for key, text in values:
+    add(key, data(g.g_variant_new_variant(parse(None, text))))
+
+def djb(key):
+    h = 5381
+    for b in key.encode():
+        if b >= 128:
+            b -= 256
+        h = (h * 33 + b) & 0xffffffff
+    return h
+
+buf = bytearray(24)
+def allocate(align, size):
+    while len(buf) % align:
+        buf.append(0)
+    start = len(buf)
+    buf.extend(b"\0" * size)
+    return start, start + size
+
+n_buckets = len(items)
+buckets = [[] for _ in range(n_buckets)]
+for key in items:
+    buckets[djb(key) % n_buckets].insert(0, key)
+order = [key for bucket in buckets for key in bucket]
+index = {key: i for i, key in enumerate(order)}
+
+size = 8 + 4 * n_buckets + 24 * len(order)
+table_start, table_end = allocate(4, size)
+struct.pack_into("<II", buf, table_start, 0, n_buckets)
+pos = 0
+for i, bucket in enumerate(buckets):
+    struct.pack_into("<I", buf, table_start + 8 + 4 * i, pos)
+    pos += len(bucket)
+
+items_start = table_start + 8 + 4 * n_buckets
+for key in order:
+    item = items[key]
+    parent = item["parent"]
+    basename = key[len(parent):] if parent else key
+    kstart, kend = allocate(1, len(basename.encode()))
+    buf[kstart:kend] = basename.encode()
+    if item["value"] is not None:
+        vstart, vend = allocate(8, len(item["value"]))
+        buf[vstart:vend] = item["value"]
+        kind = b"v"
+    else:
+        vstart, vend = allocate(4, 4 * len(item["children"]))
+        for i, child in enumerate(item["children"]):
+            struct.pack_into("<I", buf, vstart + 4 * i, index[child])
+        kind = b"L"
+    struct.pack_into("<IIIHccII", buf, items_start + 24 * index[key],
+                     djb(key), index[parent] if parent else 0xffffffff,
+                     kstart, kend - kstart, kind, b"\0", vstart, vend)
+
+struct.pack_into("<8sIIII", buf, 0, b"GVariant", 0, 0, table_start, table_end)
+open(out + "/user", "wb").write(buf)
+
+# 用 GLib 的 GVDB 读取器校验目录结构
+gio.g_resource_load.restype = vp
+gio.g_resource_load.argtypes = [ctypes.c_char_p, vp]
+gio.g_resource_enumerate_children.restype = ctypes.POINTER(ctypes.c_char_p)
+gio.g_resource_enumerate_children.argtypes = [vp, ctypes.c_char_p, ctypes.c_int, vp]
+res = gio.g_resource_load((out + "/user").encode(), None)
+assert res
+for path in ["/", "/system/", "/system/proxy/", "/system/proxy/http/", "/org/gnome/desktop/"]:
+    names = gio.g_resource_enumerate_children(res, path.encode(), 0, None)
+    assert names, path
+    got = []
+    i = 0
+    while names[i]:
+        got.append(names[i].decode())
+        i += 1
+    print(path, sorted(got))
+
+# 变更集：键按名称排序，字符串数组超过 255 字节以覆盖 2 字节偏移量
+changeset = [
+    ("/system/proxy/http/host", "'127.0.0.1'"),
+    ("/system/proxy/http/port", "7890"),
+    ("/system/proxy/ignore-hosts", "[" + ", ".join("'host%02d.example.com'" % i for i in range(16)) + "]"),
+    ("/system/proxy/mode", "'manual'"),
+    ("/system/proxy/use-same-proxy", "true"),
+]
+text = "{" + ", ".join("'%s': <%s>" % kv for kv in changeset) + "}"
+open(out + "/changeset", "wb").write(data(parse("a{smv}", text)))
+open(out + "/changeset-small", "wb").write(data(parse("a{smv}", "{'/system/proxy/mode': <'none'>}")))
@@ -0,0 +1,121 @@
+// fakecore 模拟核心在配置测试中的行为，供 manager 的测试在沙盒中运行
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func main() {
+	var raw string
+	for i, arg := range os.Args {
+		if arg == "-v" {
+			fmt.Println("Mihomo Meta fakecore")
+			return
+		}
+		if arg == "-config" && i+1 < len(os.Args) {
+			raw = os.Args[i+1]
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		fatal(err.Error())
+	}
+	var conf struct {
+		Controller string `yaml:"external-controller"`
+		Secret     string `yaml:"secret"`
+		Listeners  []struct {
+			Port int `yaml:"port"`
+		} `yaml:"listeners"`
+		// Fatal 模拟核心解析配置失败
+		Fatal string `yaml:"x-fatal"`
+		// BrokenProxy 模拟代理暂时无法连接目标
+		BrokenProxy bool `yaml:"x-broken-proxy"`
+	}
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		fatal(err.Error())
+	}
+	if conf.Fatal != "" {
+		fatal(conf.Fatal)
+	}
+
+	for _, listener := range conf.Listeners {
+		l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", listener.Port))
+		if err != nil {
+			fatal(err.Error())
+		}
+		handler := http.HandlerFunc(proxy)
+		if conf.BrokenProxy {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "connect timeout", http.StatusBadGateway)
+			}
+		}
+		go http.Serve(l, handler)
+	}
+	l, err := net.Listen("tcp", conf.Controller)
+	if err != nil {
+		fatal(err.Error())
+	}
+	go http.Serve(l, controller(conf.Secret))
+
+	logf("info", "Start initial Compatible provider default")
+	time.Sleep(time.Minute)
+}
+
+func logf(level, format string, args ...any) {
+	fmt.Printf("time=%q level=%s msg=%q\n", time.Now().Format(time.RFC3339), level, fmt.Sprintf(format, args...))
+}
+
+func fatal(msg string) {
+	logf("fatal", "%s", msg)
+	os.Exit(1)
+}
+
+// proxy 以 DIRECT 转发 HTTP 代理请求
+func proxy(w http.ResponseWriter, r *http.Request) {
+	logf("info", "[TCP] %s --> %s match IPCIDR(127.0.0.1/32) using DIRECT", r.RemoteAddr, r.Host)
+	r.RequestURI = ""
+	resp, err := (&http.Transport{}).RoundTrip(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+func controller(secret string) http.Handler {
+	selected := map[string]string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"hello": "mihomo"})
+	})
+	mux.HandleFunc("PUT /proxies/{name}", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name string `json:"name"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		selected[r.PathValue("name")] = body.Name
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /proxies/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		json.NewEncoder(w).Encode(map[string]string{"name": name, "now": selected[name]})
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+secret {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
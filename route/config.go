@@ -3,6 +3,7 @@ package route
 import (
 	"net/http"
 	"sparkle-service/config"
+	"sparkle-service/manager"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
@@ -18,6 +19,15 @@ type Config struct {
 	Http       string `json:"http-listen"`
 	NamedPipe  string `json:"named-pipe"`
 	UnixSocket string `json:"unix-socket"`
+
+	SandboxPool      *int `json:"sandbox-pool"`
+	CheckParallelism *int `json:"check-parallelism"`
+
+	RestoreOnDisable *bool `json:"restore-on-disable"`
+	SysproxyGuard    *bool `json:"sysproxy-guard"`
+
+	SysproxyTargets     *[]string `json:"sysproxy-targets"`
+	SysproxyConnections *[]string `json:"sysproxy-nm-connections"`
 }
 
 func configRouter() http.Handler {
@@ -63,5 +73,31 @@ func updateConfig(w http.ResponseWriter, r *http.Request) {
 		sendError(w, err)
 		return
 	}
+	if err := config.UpdateSandboxConfig(cfg.SandboxPool, cfg.CheckParallelism); err != nil {
+		sendError(w, err)
+		return
+	}
+	if err := config.UpdateSysproxyConfig(cfg.RestoreOnDisable, nil); err != nil {
+		sendError(w, err)
+		return
+	}
+	if cfg.SysproxyGuard != nil {
+		if err := manager.SetProxyGuard(*cfg.SysproxyGuard); err != nil {
+			sendError(w, err)
+			return
+		}
+	}
+	if cfg.SysproxyTargets != nil {
+		if err := manager.SetProxyTargets(*cfg.SysproxyTargets); err != nil {
+			sendError(w, err)
+			return
+		}
+	}
+	if cfg.SysproxyConnections != nil {
+		if err := config.UpdateSysproxyConnections(*cfg.SysproxyConnections); err != nil {
+			sendError(w, err)
+			return
+		}
+	}
 	render.JSON(w, r, "success")
 }
@@ -4,6 +4,7 @@ import (
 	"io"
 	"net/http"
 	"sparkle-service/manager"
+	"strconv"
 	"sync/atomic"
 
 	"github.com/go-chi/chi/v5"
@@ -30,6 +31,10 @@ func coreManager() http.Handler {
 	r.Post("/stop", coreStop)
 	r.Post("/restart", coreRestart)
 	r.Post("/test", coreTest)
+	r.Post("/test/latency", coreTestLatency)
+	r.Post("/explain", coreExplain)
+	r.Post("/diff", coreDiff)
+	r.Post("/exec", coreExec)
 
 	return r
 }
@@ -74,9 +79,66 @@ func coreTest(w http.ResponseWriter, r *http.Request) {
 		sendError(w, err)
 		return
 	}
-	if err := manager.ConfigCheck(string(body)); err != nil {
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	if err := manager.ConfigCheck(string(body), force); err != nil {
 		sendError(w, err)
 		return
 	}
 	sendJSON(w, "success", "测试成功完成")
 }
+
+func coreTestLatency(w http.ResponseWriter, r *http.Request) {
+	var opts manager.LatencyOptions
+	if err := decodeRequest(r, &opts); err != nil {
+		sendError(w, err)
+		return
+	}
+	results, err := manager.LatencyTest(opts)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	render.JSON(w, r, results)
+}
+
+func coreExplain(w http.ResponseWriter, r *http.Request) {
+	var req manager.ExplainRequest
+	if err := decodeRequest(r, &req); err != nil {
+		sendError(w, err)
+		return
+	}
+	result, err := manager.ExplainRuleMatch(req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	render.JSON(w, r, result)
+}
+
+func coreDiff(w http.ResponseWriter, r *http.Request) {
+	var req manager.DiffRequest
+	if err := decodeRequest(r, &req); err != nil {
+		sendError(w, err)
+		return
+	}
+	diff, err := manager.DiffConfig(req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	render.JSON(w, r, diff)
+}
+
+func coreExec(w http.ResponseWriter, r *http.Request) {
+	var req manager.ExecRequest
+	if err := decodeRequest(r, &req); err != nil {
+		sendError(w, err)
+		return
+	}
+	result, err := manager.CoreExec(r.Context(), req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	render.JSON(w, r, result)
+}
@@ -0,0 +1,68 @@
+package route
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sparkle-service/manager"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// pacAddr 为 PAC 脚本的监听地址。系统与浏览器读取 PAC 时不携带凭据，
+// 因此脚本不经过认证，只在单独的回环地址上提供，局域网中的设备无法读取
+var pacAddr string
+
+// startPac 监听回环地址后在后台提供 PAC 脚本
+func startPac(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("PAC 只能监听回环地址：%s", addr)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("pac listen error: %w", err)
+	}
+	log.Printf("pac listening at: %s", l.Addr().String())
+	pacAddr = l.Addr().String()
+
+	server := &http.Server{
+		Handler: pacRouter(),
+	}
+	go func() {
+		if err := server.Serve(l); err != nil {
+			log.Printf("pac server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+func pacRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/pac/{name}.pac", servePac)
+	return r
+}
+
+func servePac(w http.ResponseWriter, r *http.Request) {
+	script, err := manager.LoadPac(chi.URLParam(r, "name"))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	if script == "" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	_, _ = io.WriteString(w, script)
+}
+
+// pacURL 返回脚本的地址，PAC 服务未启动时无法提供
+func pacURL(name string) (string, error) {
+	if pacAddr == "" {
+		return "", fmt.Errorf("PAC 服务未启动，无法提供 PAC 脚本")
+	}
+	return fmt.Sprintf("http://%s/pac/%s.pac", pacAddr, name), nil
+}
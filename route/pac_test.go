@@ -0,0 +1,48 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStartPac(t *testing.T) {
+	defer func(addr string) { pacAddr = addr }(pacAddr)
+
+	for _, addr := range []string{"0.0.0.0:0", ":0", "[::]:0", "192.0.2.1:0"} {
+		if err := startPac(addr); err == nil {
+			t.Errorf("startPac(%q) 未拒绝非回环地址", addr)
+		}
+	}
+
+	pacAddr = ""
+	if _, err := pacURL("sparkle"); err == nil {
+		t.Error("PAC 服务未启动时 pacURL() 未返回错误")
+	}
+
+	if err := startPac("127.0.0.1:0"); err != nil {
+		t.Fatalf("startPac() error = %v", err)
+	}
+	url, err := pacURL("sparkle")
+	if err != nil || url != "http://"+pacAddr+"/pac/sparkle.pac" {
+		t.Fatalf("pacURL() = %q, %v", url, err)
+	}
+
+	// PAC 监听地址只提供脚本，不提供需要认证的接口
+	resp, err := http.Get("http://" + pacAddr + "/sysproxy/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("PAC 监听地址上的其他路径状态码 = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestPacNotOnMainRouter(t *testing.T) {
+	w := httptest.NewRecorder()
+	router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pac/sparkle.pac", nil))
+	if w.Code == http.StatusOK {
+		t.Error("主接口仍提供未认证的 PAC 脚本")
+	}
+}
@@ -0,0 +1,62 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"sparkle-service/manager/converter"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type ConvertRequest struct {
+	Content         string `json:"content"`
+	Format          string `json:"format"`
+	Template        string `json:"template"`
+	TemplateContent string `json:"template_content"`
+}
+
+type ConvertResponse struct {
+	YAML   string                `json:"yaml"`
+	Count  int                   `json:"count"`
+	Errors []converter.LinkError `json:"errors"`
+}
+
+func profilesRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Post("/convert", convertProfile)
+	return r
+}
+
+func convertProfile(w http.ResponseWriter, r *http.Request) {
+	var req ConvertRequest
+	if err := decodeRequest(r, &req); err != nil {
+		sendError(w, err)
+		return
+	}
+
+	result := converter.Convert(req.Content)
+
+	var (
+		out []byte
+		err error
+	)
+	switch req.Format {
+	case "", "proxies":
+		out, err = converter.Proxies(result.Proxies)
+	case "config":
+		out, err = converter.BuildConfig(result.Proxies, req.Template, req.TemplateContent)
+	default:
+		err = fmt.Errorf("不支持的输出格式: %s", req.Format)
+	}
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	render.JSON(w, r, ConvertResponse{
+		YAML:   string(out),
+		Count:  len(result.Proxies),
+		Errors: result.Errors,
+	})
+}
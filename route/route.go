@@ -22,6 +22,8 @@ func router() *chi.Mux {
 		r.Mount("/config", configRouter())
 		r.Mount("/sysproxy", httpProxyRouter())
 		r.Mount("/core", coreManager())
+		r.Mount("/profiles", profilesRouter())
+		r.Mount("/sandbox", sandboxRouter())
 	})
 	return r
 }
@@ -0,0 +1,28 @@
+package route
+
+import (
+	"net/http"
+	"sparkle-service/manager/sandbox"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+func sandboxRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", listSandboxes)
+	r.Delete("/{id}", killSandbox)
+	return r
+}
+
+func listSandboxes(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, sandbox.List())
+}
+
+func killSandbox(w http.ResponseWriter, r *http.Request) {
+	if err := sandbox.Kill(chi.URLParam(r, "id")); err != nil {
+		sendError(w, err)
+		return
+	}
+	sendJSON(w, "success", "沙盒已结束")
+}
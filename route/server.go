@@ -29,10 +29,16 @@ func start() error {
 	// 	return err
 	// }
 	if runtime.GOOS == "windows" {
+		if err := startPac("127.0.0.1:10002"); err != nil {
+			return err
+		}
 		if err := startServer("127.0.0.1:10001", StartHTTP); err != nil {
 			return err
 		}
 	} else {
+		if err := startPac("127.0.0.1:10011"); err != nil {
+			return err
+		}
 		if err := startServer("127.0.0.1:10010", StartHTTP); err != nil {
 			return err
 		}
@@ -3,10 +3,16 @@ package route
 import (
 	"log"
 	"sparkle-service/config"
+	"sparkle-service/manager"
+	"sparkle-service/manager/sandbox"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+// 遗留沙盒的清理间隔
+const sandboxSweepInterval = 10 * time.Minute
+
 var ServerCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Start server",
@@ -14,6 +20,8 @@ var ServerCmd = &cobra.Command{
 		if err := config.Initialize("", ""); err != nil {
 			log.Fatal(err)
 		}
+		sandbox.StartJanitor(sandboxSweepInterval)
+		manager.WarmSandboxPool()
 		if err := start(); err != nil {
 			log.Fatal(err)
 		}
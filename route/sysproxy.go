@@ -16,14 +16,30 @@ type Request struct {
 	Server  string `json:"server"`
 	Bypass  string `json:"bypass"`
 	Url     string `json:"url"`
+
+	HTTPServer  string `json:"http_server"`
+	HTTPSServer string `json:"https_server"`
+	SocksServer string `json:"socks_server"`
+	FTPServer   string `json:"ftp_server"`
+	SameForAll  *bool  `json:"same_for_all"`
+
+	// Generate 不为空时生成 PAC 脚本并由服务提供，忽略 Url
+	Generate *manager.PacSpec `json:"generate"`
 }
 
 func httpProxyRouter() http.Handler {
 	r := chi.NewRouter()
+	r.Get("/detect", detect)
+	r.Get("/sessions", sessions)
+	r.Get("/targets", targets)
+	r.Get("/guard", guardStatus)
+	r.Post("/guard", setGuard)
+	r.Get("/pac/evaluate", evaluatePac)
 	r.Get("/*", status)
 	r.Post("/pac", pac)
 	r.Post("/proxy", proxy)
 	r.Post("/disable", disable)
+	r.Post("/restore", restore)
 	return r
 }
 
@@ -41,6 +57,33 @@ func status(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, status)
 }
 
+func detect(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.ParseUint(r.Header.Get("UID"), 10, 32)
+	if err != nil {
+		sendError(w, fmt.Errorf("invalid UID: %v", err))
+		return
+	}
+	info, err := manager.DetectDesktop(uint32(uid))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	render.JSON(w, r, info)
+}
+
+func sessions(w http.ResponseWriter, r *http.Request) {
+	list, err := manager.ListUserSessions()
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	render.JSON(w, r, list)
+}
+
+func targets(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, manager.ProxyTargetStatus())
+}
+
 func pac(w http.ResponseWriter, r *http.Request) {
 	var req Request
 	if err := decodeRequest(r, &req); err != nil {
@@ -48,7 +91,20 @@ func pac(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := manager.SetPac(req.Url, req.Desktop, req.UID)
+	url := req.Url
+	if req.Generate != nil {
+		name, err := manager.SavePac(*req.Generate)
+		if err != nil {
+			sendError(w, err)
+			return
+		}
+		if url, err = pacURL(name); err != nil {
+			sendError(w, err)
+			return
+		}
+	}
+
+	err := manager.SetPac(url, req.Desktop, req.UID)
 	if err != nil {
 		sendError(w, err)
 		return
@@ -56,6 +112,25 @@ func pac(w http.ResponseWriter, r *http.Request) {
 	render.NoContent(w, r)
 }
 
+// evaluatePac 计算生成的 PAC 脚本对指定地址返回的代理
+func evaluatePac(w http.ResponseWriter, r *http.Request) {
+	script, err := manager.LoadPac(r.URL.Query().Get("name"))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	if script == "" {
+		sendError(w, fmt.Errorf("PAC 脚本不存在"))
+		return
+	}
+	result, err := manager.EvaluatePac(script, r.URL.Query().Get("url"))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	render.JSON(w, r, render.M{"result": result})
+}
+
 func proxy(w http.ResponseWriter, r *http.Request) {
 	var req Request
 	if err := decodeRequest(r, &req); err != nil {
@@ -63,7 +138,15 @@ func proxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := manager.SetProxy(req.Server, req.Bypass, req.Desktop, req.UID)
+	servers := manager.ProxyServers{
+		Server:     req.Server,
+		HTTP:       req.HTTPServer,
+		HTTPS:      req.HTTPSServer,
+		SOCKS:      req.SocksServer,
+		FTP:        req.FTPServer,
+		SameForAll: req.SameForAll,
+	}
+	err := manager.SetProxy(servers, req.Bypass, req.Desktop, req.UID)
 	if err != nil {
 		sendError(w, err)
 		return
@@ -81,10 +164,45 @@ func disable(w http.ResponseWriter, r *http.Request) {
 	err := manager.DisableProxy(req.Desktop, req.UID)
 	if err != nil {
 		sendError(w, err)
+		return
 	}
 	render.NoContent(w, r)
 }
 
+func restore(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := decodeRequest(r, &req); err != nil {
+		sendError(w, err)
+		return
+	}
+
+	if err := manager.RestoreProxy(req.Desktop, req.UID); err != nil {
+		sendError(w, err)
+		return
+	}
+	render.NoContent(w, r)
+}
+
+func guardStatus(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, manager.ProxyGuardStatus())
+}
+
+func setGuard(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enable bool `json:"enable"`
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		sendError(w, err)
+		return
+	}
+
+	if err := manager.SetProxyGuard(req.Enable); err != nil {
+		sendError(w, err)
+		return
+	}
+	render.JSON(w, r, manager.ProxyGuardStatus())
+}
+
 func decodeRequest(r *http.Request, v any) error {
 	if r.ContentLength > 0 {
 		return render.DecodeJSON(r.Body, v)